@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/media"
+	"good_morning_backend/internal/models"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultDeletionGracePeriod is how long a deleted account can still be restored; override with ACCOUNT_DELETION_GRACE_PERIOD
+	DefaultDeletionGracePeriod = 7 * 24 * time.Hour
+	accountPurgeInterval       = time.Hour
+	// deleting an account needs a session signed in this recently, so a stolen or forgotten one can't do it
+	recentSignInWindow = 10 * time.Minute
+)
+
+var (
+	errNotPendingDeletion = errors.New("account is not pending deletion")
+	errPendingDeletion    = errors.New("account is scheduled for deletion")
+	errPartnerPending     = errors.New("your partner's account is scheduled for deletion")
+)
+
+// checkNoticeAllowed stops notices in either direction while one side of the pair is waiting to be deleted
+func checkNoticeAllowed(sender, recipient *models.User) error {
+	if sender.DeleteAfter != nil {
+		return errPendingDeletion
+	}
+	if recipient.DeleteAfter != nil {
+		return errPartnerPending
+	}
+	return nil
+}
+
+// deletionGracePeriod reads ACCOUNT_DELETION_GRACE_PERIOD as a duration; 0 deletes accounts straight away
+func deletionGracePeriod() time.Duration {
+	v := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if v == "" {
+		return DefaultDeletionGracePeriod
+	}
+	grace, err := time.ParseDuration(v)
+	if err != nil || grace < 0 {
+		log.Printf("invalid ACCOUNT_DELETION_GRACE_PERIOD %q, using %s", v, DefaultDeletionGracePeriod)
+		return DefaultDeletionGracePeriod
+	}
+	return grace
+}
+
+// handleDeleteAccount schedules the account for deletion. The user has to have signed in within the last few
+// minutes and type their username to confirm, and can change their mind until the grace period runs out.
+// Scheduling signs out every other session and revokes all API tokens
+func handleDeleteAccount(c *gin.Context) {
+	userID := c.GetString("user_id")
+	sessionID := c.GetString("session_id")
+
+	var requestBody struct {
+		Confirm string `json:"confirm" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if strings.TrimSpace(requestBody.Confirm) != user.Username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "type your username to confirm"})
+		return
+	}
+
+	session, err := activeSession(sessionID, userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	if time.Since(session.CreatedAt) > recentSignInWindow {
+		c.JSON(http.StatusForbidden, gin.H{"error": "sign in again to delete your account", "reauthenticate": true})
+		return
+	}
+
+	grace := deletionGracePeriod()
+	if grace == 0 {
+		if err := purgeAccount(c.Request.Context(), user.ID, false); err != nil {
+			log.Printf("failed to delete account %s: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete account"})
+			return
+		}
+		clearSessionCookies(c)
+		c.JSON(http.StatusOK, gin.H{"message": "account deleted"})
+		return
+	}
+
+	deleteAfter := time.Now().Add(grace)
+	if user.DeleteAfter != nil {
+		// asking twice doesn't push the deadline back
+		deleteAfter = *user.DeleteAfter
+	}
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Update("delete_after", deleteAfter).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, sessionID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.APIToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to schedule deletion"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "account scheduled for deletion", "deleteAfter": deleteAfter})
+}
+
+func handleCancelAccountDeletion(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result := database.DB.Model(&models.User{}).
+		Where("id = ? AND delete_after IS NOT NULL", userID).
+		Update("delete_after", nil)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel deletion"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": errNotPendingDeletion.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "account deletion cancelled"})
+}
+
+// startAccountPurge periodically deletes accounts whose grace period has run out
+func startAccountPurge(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(accountPurgeInterval)
+		defer ticker.Stop()
+		for {
+			var userIDs []string
+			err := database.DB.WithContext(ctx).Model(&models.User{}).
+				Where("delete_after IS NOT NULL AND delete_after <= ?", time.Now()).
+				Pluck("id", &userIDs).Error
+			if err != nil {
+				log.Printf("account purge failed: %v", err)
+			}
+			for _, userID := range userIDs {
+				err := purgeAccount(ctx, userID, true)
+				switch {
+				case errors.Is(err, errNotPendingDeletion):
+					// cancelled since the query above
+				case err != nil:
+					log.Printf("account purge: failed to delete %s: %v", userID, err)
+				default:
+					log.Printf("account purge: deleted %s", userID)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// purgeAccount removes the user and everything that belongs to them. Notices they sent or received go
+// too, since the partner's copy of the conversation can't be kept without the other half of it. Stored
+// files are deleted before their rows, so a failure leaves the rows for the next sweep to retry rather
+// than files nothing points at. With onlyIfDue the account is left alone unless its grace period has run out
+func purgeAccount(ctx context.Context, userID string, onlyIfDue bool) error {
+	return database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+		// a sweep can race with a cancellation
+		if onlyIfDue && (user.DeleteAfter == nil || user.DeleteAfter.After(time.Now())) {
+			return errNotPendingDeletion
+		}
+
+		if err := tx.Model(&models.User{}).
+			Where("paired_user_id = ?", user.ID).
+			Update("paired_user_id", nil).Error; err != nil {
+			return err
+		}
+
+		notices := tx.Model(&models.Notice{}).Select("id").Where("sender_id = ? OR recipient_id = ?", user.ID, user.ID)
+		var files []models.Media
+		if err := tx.Where("owner_id = ? OR notice_id IN (?)", user.ID, notices).Find(&files).Error; err != nil {
+			return err
+		}
+		for _, m := range files {
+			if err := media.Store.Delete(ctx, m.Key); err != nil {
+				return fmt.Errorf("delete %s from storage: %w", m.Key, err)
+			}
+		}
+		if err := tx.Where("owner_id = ? OR notice_id IN (?)", user.ID, notices).Delete(&models.Media{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("notice_id IN (?)", notices).Delete(&models.NoticeMedia{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("sender_id = ? OR recipient_id = ?", user.ID, user.ID).Delete(&models.Notice{}).Error; err != nil {
+			return err
+		}
+
+		owned := []interface{}{
+			&models.PushSubscription{},
+			&models.Session{},
+			&models.Identity{},
+			&models.Credential{},
+			&models.WebAuthnChallenge{},
+			&models.APIToken{},
+			&models.SpotifyAccount{},
+		}
+		for _, model := range owned {
+			if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.LoginToken{}).Error; err != nil {
+			return err
+		}
+		if user.Email != "" {
+			if err := tx.Where("LOWER(email) = ?", strings.ToLower(user.Email)).Delete(&models.LoginToken{}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&user).Error
+	})
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"good_morning_backend/internal/models"
+)
+
+func TestCheckNoticeAllowed(t *testing.T) {
+	later := time.Now().Add(DefaultDeletionGracePeriod)
+	tests := []struct {
+		name      string
+		sender    models.User
+		recipient models.User
+		want      error
+	}{
+		{"both active", models.User{}, models.User{}, nil},
+		{"sender pending deletion", models.User{DeleteAfter: &later}, models.User{}, errPendingDeletion},
+		{"partner pending deletion", models.User{}, models.User{DeleteAfter: &later}, errPartnerPending},
+		{"both pending deletion", models.User{DeleteAfter: &later}, models.User{DeleteAfter: &later}, errPendingDeletion},
+	}
+	for _, tt := range tests {
+		if got := checkNoticeAllowed(&tt.sender, &tt.recipient); got != tt.want {
+			t.Errorf("%s: checkNoticeAllowed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/id"
+	"good_morning_backend/internal/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	ScopeReadNotice = "read-notice"
+	ScopeSendNotice = "send-notice"
+
+	apiTokenPrefix        = "gm_"
+	MaxAPITokensPerUser   = 20
+	MaxAPITokenNameLength = 64
+	// how stale LastUsedAt can get before a request bumps it
+	apiTokenUsedInterval = time.Minute
+)
+
+var apiTokenScopes = map[string]bool{
+	ScopeReadNotice: true,
+	ScopeSendNotice: true,
+}
+
+// apiTokenRoutes is everything an API token can reach, and the scope each needs; anything not listed
+// (including managing tokens and sessions) needs a browser session
+var apiTokenRoutes = map[string]string{
+	"GET /notices/get":     ScopeReadNotice,
+	"POST /notices/create": ScopeSendNotice,
+}
+
+var errAPITokenInvalid = errors.New("api token revoked, expired or unknown")
+
+func newAPIToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func activeAPIToken(raw string) (*models.APIToken, error) {
+	var token models.APIToken
+	err := database.DB.Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", hashToken(raw), time.Now()).
+		First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errAPITokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIToken is authMiddleware's path for Authorization: Bearer requests
+func authenticateAPIToken(c *gin.Context, raw string) {
+	token, err := activeAPIToken(raw)
+	if err != nil {
+		if errors.Is(err, errAPITokenInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+		}
+		c.Abort()
+		return
+	}
+
+	scope, ok := apiTokenRoutes[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not available to API tokens"})
+		c.Abort()
+		return
+	}
+	if !hasScope(token.Scopes, scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "token is missing the " + scope + " scope"})
+		c.Abort()
+		return
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > apiTokenUsedInterval {
+		database.DB.Model(token).Update("last_used_at", time.Now())
+	}
+
+	c.Set("user_id", token.UserID)
+	c.Set("api_token_id", token.ID)
+	c.Next()
+}
+
+func handleListAPITokens(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var tokens []models.APIToken
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// handleCreateAPIToken returns the token once; after this only its prefix is ever shown
+func handleCreateAPIToken(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays *int     `json:"expiresInDays"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len([]rune(req.Name)) > MaxAPITokenNameLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("name must be 1-%d characters", MaxAPITokenNameLength)})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one scope is required"})
+		return
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !apiTokenScopes[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope: " + scope})
+			return
+		}
+		if !hasScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expiresInDays must be between 1 and 365"})
+			return
+		}
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+	if count >= MaxAPITokensPerUser {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("you can have at most %d tokens", MaxAPITokensPerUser)})
+		return
+	}
+
+	raw := newAPIToken()
+	token := models.APIToken{
+		ID:        id.New(id.APIToken),
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    raw[:len(apiTokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token, "secret": raw})
+}
+
+func handleRevokeAPIToken(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	result := database.DB.Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
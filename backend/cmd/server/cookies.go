@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// cookieConfig holds the attributes every cookie we set shares
+type cookieConfig struct {
+	Secure   bool
+	SameSite http.SameSite
+	Domain   string
+}
+
+var (
+	cookieSettings     cookieConfig
+	cookieSettingsOnce sync.Once
+)
+
+// cookieConfigFromEnv reads COOKIE_SECURE, COOKIE_SAMESITE and COOKIE_DOMAIN. Secure defaults to on
+// when the frontend is served over https, and SameSite=None always forces Secure since browsers require it
+func cookieConfigFromEnv() cookieConfig {
+	cookieSettingsOnce.Do(func() {
+		cfg := cookieConfig{
+			Secure:   strings.HasPrefix(os.Getenv("FRONTEND_URL"), "https://"),
+			SameSite: http.SameSiteLaxMode,
+			Domain:   os.Getenv("COOKIE_DOMAIN"),
+		}
+		if v := os.Getenv("COOKIE_SECURE"); v != "" {
+			secure, err := strconv.ParseBool(v)
+			if err != nil {
+				log.Printf("invalid COOKIE_SECURE %q, using %v", v, cfg.Secure)
+			} else {
+				cfg.Secure = secure
+			}
+		}
+		switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+		case "", "lax":
+		case "strict":
+			cfg.SameSite = http.SameSiteStrictMode
+		case "none":
+			cfg.SameSite = http.SameSiteNoneMode
+			cfg.Secure = true
+		default:
+			log.Printf("invalid COOKIE_SAMESITE %q, using lax", os.Getenv("COOKIE_SAMESITE"))
+		}
+		cookieSettings = cfg
+	})
+	return cookieSettings
+}
+
+// setCookie sets an HTTP-only cookie with the configured attributes; a negative maxAge deletes it
+func setCookie(c *gin.Context, name, value string, maxAge int, path string) {
+	writeCookie(c, name, value, maxAge, path, true, cookieConfigFromEnv().SameSite)
+}
+
+// setRedirectCookie is for state that must survive the redirect back from an OAuth provider,
+// which a strict cookie would not
+func setRedirectCookie(c *gin.Context, name, value string, maxAge int, path string) {
+	sameSite := cookieConfigFromEnv().SameSite
+	if sameSite == http.SameSiteStrictMode {
+		sameSite = http.SameSiteLaxMode
+	}
+	writeCookie(c, name, value, maxAge, path, true, sameSite)
+}
+
+func writeCookie(c *gin.Context, name, value string, maxAge int, path string, httpOnly bool, sameSite http.SameSite) {
+	cfg := cookieConfigFromEnv()
+	if maxAge < 0 {
+		value = ""
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		MaxAge:   maxAge,
+		Path:     path,
+		Domain:   cfg.Domain,
+		Secure:   cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	})
+}
+
+// csrfToken is "<nonce>.<mac>" with the mac bound to the session, so a token planted by a
+// sibling subdomain can't be paired with someone else's session
+func csrfToken(sessionID string) string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	return nonce + "." + csrfMAC(sessionID, nonce)
+}
+
+func csrfMAC(sessionID, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("JWT_SECRET")))
+	mac.Write([]byte("csrf:" + sessionID + ":" + nonce))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func validCSRFToken(sessionID, token string) bool {
+	nonce, mac, ok := strings.Cut(token, ".")
+	if !ok || nonce == "" {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(csrfMAC(sessionID, nonce)))
+}
+
+// setCSRFCookie issues a token the frontend can read and echo back in the X-CSRF-Token header
+func setCSRFCookie(c *gin.Context, sessionID string, maxAge int) {
+	writeCookie(c, csrfCookie, csrfToken(sessionID), maxAge, "/", false, cookieConfigFromEnv().SameSite)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// csrfMiddleware implements double-submit: unsafe requests must send the csrf_token cookie's value in
+// the X-CSRF-Token header, which a cross-site form or fetch can't read. Must run after authMiddleware
+func csrfMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// bearer tokens aren't sent automatically by the browser, so they can't be forged cross-site
+		if c.GetString("api_token_id") != "" {
+			c.Next()
+			return
+		}
+
+		sessionID := c.GetString("session_id")
+		cookie, err := c.Cookie(csrfCookie)
+		hasValidCookie := err == nil && validCSRFToken(sessionID, cookie)
+
+		if isSafeMethod(c.Request.Method) {
+			// sessions started before this cookie existed pick one up on their next read
+			if !hasValidCookie {
+				setCSRFCookie(c, sessionID, int(SessionTTL.Seconds()))
+			}
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader(csrfHeader)
+		if !hasValidCookie || header == "" || !hmac.Equal([]byte(header), []byte(cookie)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "invalid csrf token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrateGoogleIdentities copies the old User.GoogleID column into Identity rows; it's idempotent
+func migrateGoogleIdentities() error {
+	return database.DB.Exec(`
+		INSERT INTO "Identity" (id, user_id, provider, subject, email, created_at)
+		SELECT 'identity_google_' || id, id, 'google', google_id, email, NOW()
+		FROM "User"
+		WHERE google_id IS NOT NULL AND google_id <> ''
+		ON CONFLICT DO NOTHING
+	`).Error
+}
+
+func handleListIdentities(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var identities []models.Identity
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get identities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// errLastLoginMethod stops a user removing their only way to sign in. Identities and passkeys both count,
+// so someone who signs in with a passkey can drop their last provider login, and the other way round
+var errLastLoginMethod = errors.New("can't remove your only login method")
+
+// deleteLoginMethod deletes the user's identity or passkey with that id, as long as another login method is left.
+// The user row is locked so two concurrent removals can't each see the other's method as remaining
+func deleteLoginMethod(userID, methodID string, model interface{}) (bool, error) {
+	deleted := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).First(&user).Error; err != nil {
+			return err
+		}
+
+		var identities, passkeys int64
+		if err := tx.Model(&models.Identity{}).Where("user_id = ?", userID).Count(&identities).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Credential{}).Where("user_id = ?", userID).Count(&passkeys).Error; err != nil {
+			return err
+		}
+
+		result := tx.Where("id = ? AND user_id = ?", methodID, userID).Delete(model)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 && identities+passkeys <= 1 {
+			return errLastLoginMethod
+		}
+		deleted = result.RowsAffected > 0
+		return nil
+	})
+	return deleted, err
+}
+
+// handleDeleteIdentity unlinks a login method, as long as it isn't the user's last way in
+func handleDeleteIdentity(c *gin.Context) {
+	deleted, err := deleteLoginMethod(c.GetString("user_id"), c.Param("id"), &models.Identity{})
+	if errors.Is(err, errLastLoginMethod) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove identity"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "identity removed"})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/jobs"
+	"good_morning_backend/internal/models"
+	"good_morning_backend/internal/unfurl"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MaxLinkURLLength = 2048
+	LinkPreviewTTL   = 24 * time.Hour
+	// failures are cached briefly so a dead link isn't refetched for every notice
+	LinkPreviewErrorTTL = time.Hour
+)
+
+var linkUnfurler = unfurl.New()
+
+// validateLinkURL does the cheap checks up front so obviously bad links are rejected on create
+func validateLinkURL(rawURL string) error {
+	if len(rawURL) > MaxLinkURLLength {
+		return errors.New("link is too long")
+	}
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return unfurl.ErrInvalidURL
+	}
+	return unfurl.ValidateURL(u)
+}
+
+func enqueueNoticeLink(noticeID string) {
+	metadataQueue.Enqueue("link "+noticeID, func(ctx context.Context) error {
+		return resolveNoticeLink(ctx, noticeID)
+	}, func(err error) {
+		if err := database.DB.Model(&models.Notice{}).Where("id = ?", noticeID).Update("link_status", MetadataStatusFailed).Error; err != nil {
+			log.Printf("failed to mark notice %s link as failed: %v", noticeID, err)
+		}
+	})
+}
+
+func resolveNoticeLink(ctx context.Context, noticeID string) error {
+	var notice models.Notice
+	if err := database.DB.WithContext(ctx).Where("id = ?", noticeID).First(&notice).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if notice.LinkURL == nil || *notice.LinkURL == "" {
+		return nil
+	}
+
+	preview, err := linkPreview(ctx, *notice.LinkURL)
+	if err != nil {
+		return err
+	}
+
+	return database.DB.WithContext(ctx).Model(&notice).
+		Select("link_title", "link_description", "link_image", "link_site_name", "link_status").
+		Updates(&models.Notice{
+			LinkTitle:       optionalString(preview.Title),
+			LinkDescription: optionalString(preview.Description),
+			LinkImage:       optionalString(preview.Image),
+			LinkSiteName:    optionalString(preview.SiteName),
+			LinkStatus:      MetadataStatusResolved,
+		}).Error
+}
+
+// linkPreview serves from the cache when fresh, otherwise unfurls and caches the result (or the failure)
+func linkPreview(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	var cached models.LinkPreview
+	err := database.DB.WithContext(ctx).Where("url = ?", rawURL).First(&cached).Error
+	if err == nil {
+		if cached.Error == nil && time.Since(cached.FetchedAt) < LinkPreviewTTL {
+			return &cached, nil
+		}
+		if cached.Error != nil && time.Since(cached.FetchedAt) < LinkPreviewErrorTTL {
+			return nil, jobs.Permanent(errors.New(*cached.Error))
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	preview := models.LinkPreview{URL: rawURL, FetchedAt: time.Now()}
+	result, err := linkUnfurler.Fetch(ctx, rawURL)
+	if err != nil {
+		permanent := errors.Is(err, unfurl.ErrInvalidURL) || errors.Is(err, unfurl.ErrForbidden) ||
+			errors.Is(err, unfurl.ErrNotHTML) || errors.Is(err, unfurl.ErrNoPreview)
+		if !permanent {
+			// network errors and timeouts are worth another go, don't cache them
+			return nil, err
+		}
+		message := err.Error()
+		preview.Error = &message
+		if saveErr := database.DB.WithContext(ctx).Save(&preview).Error; saveErr != nil {
+			log.Printf("failed to cache link preview error for %s: %v", rawURL, saveErr)
+		}
+		return nil, jobs.Permanent(err)
+	}
+
+	preview.Title = result.Title
+	preview.Description = result.Description
+	preview.Image = result.Image
+	preview.SiteName = result.SiteName
+	if err := database.DB.WithContext(ctx).Save(&preview).Error; err != nil {
+		log.Printf("failed to cache link preview for %s: %v", rawURL, err)
+	}
+	return &preview, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"crypto/hmac"
+	"errors"
+	"good_morning_backend/internal/auth"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/google"
+	"good_morning_backend/internal/id"
+	"good_morning_backend/internal/models"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+var errIdentityInUse = errors.New("login is already linked to another account")
+
+func handleProviderLogin(c *gin.Context) {
+	provider, ok := auth.DefaultRegistry().Get(c.Param("provider"))
+	if !ok {
+		redirectWithAuthError(c, "unknown_provider")
+		return
+	}
+
+	state := generateState()
+	verifier, challenge := generatePKCE()
+
+	err := setOAuthStateCookie(c, &oauthState{
+		Provider: provider.Name(),
+		State:    state,
+		Verifier: verifier,
+		ReturnTo: sanitizeReturnPath(c.Query("returnTo")),
+	})
+	if err != nil {
+		redirectWithAuthError(c, "server_error")
+		return
+	}
+
+	c.Redirect(http.StatusTemporaryRedirect, provider.AuthCodeURL(state, challenge))
+}
+
+func handleProviderCallback(c *gin.Context) {
+	provider, ok := auth.DefaultRegistry().Get(c.Param("provider"))
+	if !ok {
+		redirectWithAuthError(c, "unknown_provider")
+		return
+	}
+
+	st, err := consumeOAuthState(c)
+	if err != nil || st.Provider != provider.Name() {
+		redirectWithAuthError(c, "invalid_state")
+		return
+	}
+
+	// the user declined, or the provider refused the request
+	if errCode := c.Query("error"); errCode != "" {
+		if errCode == "access_denied" {
+			redirectWithAuthError(c, "access_denied")
+		} else {
+			redirectWithAuthError(c, "provider_error")
+		}
+		return
+	}
+
+	code := c.Query("code")
+
+	if code == "" {
+		redirectWithAuthError(c, "missing_code")
+		return
+	}
+
+	profile, err := provider.Exchange(code, st.Verifier)
+	if err != nil {
+		log.Printf("%s login: %v", provider.Name(), err)
+		var tokenErr *google.TokenError
+		switch {
+		case errors.Is(err, auth.ErrEmailNotVerified):
+			redirectWithAuthError(c, "email_not_verified")
+		case errors.Is(err, google.ErrInvalidIDToken):
+			redirectWithAuthError(c, "invalid_id_token")
+		case errors.As(err, &tokenErr):
+			redirectWithAuthError(c, "token_exchange_failed")
+		default:
+			redirectWithAuthError(c, "provider_error")
+		}
+		return
+	}
+
+	completeLogin(c, profile, st.ReturnTo, currentUserID(c))
+}
+
+// completeLogin signs in (or links to linkToUserID) the identity and redirects back to the frontend
+func completeLogin(c *gin.Context, profile *auth.Profile, returnTo, linkToUserID string) {
+	user, err := userForIdentity(profile, linkToUserID)
+	if err != nil {
+		log.Printf("%s login: %v", profile.Provider, err)
+		if errors.Is(err, errIdentityInUse) {
+			redirectWithAuthError(c, "identity_in_use")
+		} else {
+			redirectWithAuthError(c, "account_error")
+		}
+		return
+	}
+
+	if err := startSession(c, user.ID); err != nil {
+		redirectWithAuthError(c, "session_error")
+		return
+	}
+
+	// redirect to frontend
+	redirectToFrontend(c, returnTo)
+}
+
+// userForIdentity finds who is signing in. A known identity wins; otherwise the identity is linked to the
+// signed-in user, or to the account with the same verified email, or a new account is created for it
+func userForIdentity(profile *auth.Profile, linkToUserID string) (*models.User, error) {
+	var user models.User
+	now := time.Now()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Where("provider = ? AND subject = ?", profile.Provider, profile.Subject).First(&identity).Error
+		if err == nil {
+			if linkToUserID != "" && identity.UserID != linkToUserID {
+				return errIdentityInUse
+			}
+			if err := tx.Model(&identity).Updates(map[string]interface{}{"last_used_at": now, "email": profile.Email}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id = ?", identity.UserID).First(&user).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		switch {
+		case linkToUserID != "":
+			err = tx.Where("id = ?", linkToUserID).First(&user).Error
+		case profile.EmailVerified && profile.Email != "":
+			err = tx.Where("LOWER(email) = ?", strings.ToLower(profile.Email)).Order("created_at").First(&user).Error
+		default:
+			err = gorm.ErrRecordNotFound
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user = models.User{
+				ID:                   id.New(id.User),
+				Email:                profile.Email,
+				Username:             profile.Name,
+				Timezone:             "UTC",
+				UniqueCode:           generateUniqueCode(),
+				NotificationsEnabled: false,
+			}
+			if user.Username == "" {
+				user.Username, _, _ = strings.Cut(profile.Email, "@")
+			}
+			if profile.Picture != "" {
+				user.Picture = &profile.Picture
+			}
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.Identity{
+			ID:         id.New(id.Identity),
+			UserID:     user.ID,
+			Provider:   profile.Provider,
+			Subject:    profile.Subject,
+			Email:      profile.Email,
+			LastUsedAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// currentUserID returns the signed-in user for a login callback, so a second login method is linked to them.
+// The access token has usually expired by the time the provider redirects back, so the refresh cookie
+// (scoped to /auth, so it's sent here) is checked too, without rotating it
+func currentUserID(c *gin.Context) string {
+	if tokenString, err := c.Cookie("jwt"); err == nil {
+		secret := os.Getenv("JWT_SECRET")
+		parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256"}))
+		token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			return []byte(secret), nil
+		})
+		if err == nil && token.Valid && secret != "" {
+			claims, _ := token.Claims.(jwt.MapClaims)
+			userID, _ := claims["user_id"].(string)
+			sessionID, _ := claims["sid"].(string)
+			if _, err := activeSession(sessionID, userID); err == nil {
+				return userID
+			}
+		}
+	}
+
+	refreshToken, err := c.Cookie(refreshCookie)
+	if err != nil {
+		return ""
+	}
+	sessionID, secret, ok := parseRefreshToken(refreshToken)
+	if !ok {
+		return ""
+	}
+	var session models.Session
+	err = database.DB.Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).First(&session).Error
+	if err != nil || !hmac.Equal([]byte(hashToken(secret)), []byte(session.RefreshTokenHash)) {
+		return ""
+	}
+	return session.UserID
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"good_morning_backend/internal/auth"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/models"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	MagicLinkTTL = 15 * time.Minute
+
+	// ties the confirm form to the browser that opened the link, so another site can't post its own token
+	magicLinkNonceCookie = "magic_link_nonce"
+)
+
+func handleRequestMagicLink(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email"`
+		ReturnTo string `json:"returnTo"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	email, err := auth.NormalizeEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email address"})
+		return
+	}
+
+	if !sendMagicLink(c, email, req.ReturnTo, nil) {
+		return
+	}
+
+	// the same answer whether or not an account exists, so this can't be used to probe for users
+	c.JSON(http.StatusOK, gin.H{"message": "check your email for a sign-in link"})
+}
+
+// handleRequestEmailLink emails a link that adds the address to the signed-in user's logins.
+// Sign-in links never link anything, so owning a mailbox can't attach it to someone else's account
+func handleRequestEmailLink(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var req struct {
+		Email    string `json:"email"`
+		ReturnTo string `json:"returnTo"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		return
+	}
+
+	email, err := auth.NormalizeEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid email address"})
+		return
+	}
+
+	if !sendMagicLink(c, email, req.ReturnTo, &userID) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "check your email to confirm the address"})
+}
+
+// sendMagicLink stores a new token and emails it, writing the error response itself if that fails
+func sendMagicLink(c *gin.Context, email, returnTo string, linkToUserID *string) bool {
+	if !rateLimitRecipient(c, "email", email) {
+		return false
+	}
+
+	mailer := auth.MailerFromEnv()
+	if !mailer.Configured() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "email login is not available"})
+		return false
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	// links are single-use and short-lived, so anything a day past expiry is just clutter
+	database.DB.Where("expires_at < ?", time.Now().Add(-24*time.Hour)).Delete(&models.LoginToken{})
+
+	loginToken := models.LoginToken{
+		TokenHash: hashToken(token),
+		Email:     email,
+		UserID:    linkToUserID,
+		ReturnTo:  sanitizeReturnPath(returnTo),
+		ExpiresAt: time.Now().Add(MagicLinkTTL),
+	}
+	if err := database.DB.Create(&loginToken).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create login link"})
+		return false
+	}
+
+	link := os.Getenv("MAGIC_LINK_BASE_URL")
+	if link == "" {
+		link = "http://localhost:24804"
+	}
+	link += "/auth/email/verify?token=" + url.QueryEscape(token)
+
+	if err := mailer.SendMagicLink(email, link, MagicLinkTTL); err != nil {
+		log.Printf("failed to send magic link: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "failed to send email"})
+		return false
+	}
+	return true
+}
+
+var magicLinkPage = template.Must(template.New("magic_link").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>good morning</title>
+<style>
+body { font-family: system-ui, sans-serif; display: flex; min-height: 100vh; align-items: center; justify-content: center; margin: 0; }
+button { font: inherit; padding: 0.75em 1.5em; border-radius: 0.5em; border: none; background: #f59e0b; color: #fff; cursor: pointer; }
+</style>
+</head>
+<body>
+<form method="post" action="/auth/email/verify">
+<input type="hidden" name="token" value="{{.Token}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<button type="submit">Continue to good morning</button>
+</form>
+</body>
+</html>
+`))
+
+// handleMagicLinkPage is where emailed links land. It only shows a button that posts the token back, since
+// mail scanners and link previews fetch every URL in a message and would otherwise use up the link
+func handleMagicLinkPage(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		redirectWithAuthError(c, "invalid_link")
+		return
+	}
+
+	b := make([]byte, 32)
+	rand.Read(b)
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	writeCookie(c, magicLinkNonceCookie, nonce, int(MagicLinkTTL.Seconds()), "/auth/email", true, http.SameSiteStrictMode)
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := magicLinkPage.Execute(c.Writer, gin.H{"Token": token, "Nonce": nonce}); err != nil {
+		log.Printf("magic link page: %v", err)
+	}
+}
+
+// handleVerifyMagicLink claims the token posted from the confirm page. A sign-in link signs in (or creates)
+// the account for that email and never links to whoever is signed in; a link requested from an account
+// adds the email to that account, and only in a browser signed in to it
+func handleVerifyMagicLink(c *gin.Context) {
+	token := c.PostForm("token")
+	nonce, err := c.Cookie(magicLinkNonceCookie)
+	if token == "" || err != nil || !hmac.Equal([]byte(nonce), []byte(c.PostForm("nonce"))) {
+		redirectWithAuthError(c, "invalid_link")
+		return
+	}
+	setCookie(c, magicLinkNonceCookie, "", -1, "/auth/email")
+
+	var loginToken models.LoginToken
+	err = database.DB.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+		First(&loginToken).Error
+	if err != nil {
+		redirectWithAuthError(c, "invalid_link")
+		return
+	}
+	// checked before claiming, so signing in to the right account and clicking again still works
+	if loginToken.UserID != nil && currentUserID(c) != *loginToken.UserID {
+		redirectWithAuthError(c, "sign_in_to_link")
+		return
+	}
+
+	// claim the token atomically so it can only ever be used once
+	result := database.DB.Model(&models.LoginToken{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		redirectWithAuthError(c, "server_error")
+		return
+	}
+	if result.RowsAffected == 0 {
+		redirectWithAuthError(c, "invalid_link")
+		return
+	}
+
+	profile := &auth.Profile{
+		Provider:      "email",
+		Subject:       loginToken.Email,
+		Email:         loginToken.Email,
+		EmailVerified: true,
+	}
+	if loginToken.UserID == nil {
+		completeLogin(c, profile, loginToken.ReturnTo, "")
+		return
+	}
+
+	if _, err := userForIdentity(profile, *loginToken.UserID); err != nil {
+		log.Printf("email link: %v", err)
+		if errors.Is(err, errIdentityInUse) {
+			redirectWithAuthError(c, "identity_in_use")
+		} else {
+			redirectWithAuthError(c, "account_error")
+		}
+		return
+	}
+	redirectToFrontend(c, loginToken.ReturnTo)
+}
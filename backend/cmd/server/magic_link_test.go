@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func magicLinkRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/auth/email/verify", handleMagicLinkPage)
+	r.POST("/auth/email/verify", handleVerifyMagicLink)
+	return r
+}
+
+func TestMagicLinkPageDoesNotClaim(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "http://frontend.test")
+	r := magicLinkRouter()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, `/auth/email/verify?token=abc"><script>`, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `method="post" action="/auth/email/verify"`) {
+		t.Errorf("page has no confirm form:\n%s", body)
+	}
+	if strings.Contains(body, "<script>") || !strings.Contains(body, `value="abc&#34;&gt;&lt;script&gt;"`) {
+		t.Errorf("token isn't escaped:\n%s", body)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" || w.Header().Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("headers = %v", w.Header())
+	}
+
+	var nonce *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == magicLinkNonceCookie {
+			nonce = cookie
+		}
+	}
+	if nonce == nil || nonce.Value == "" || !nonce.HttpOnly || nonce.SameSite != http.SameSiteStrictMode || nonce.Path != "/auth/email" {
+		t.Fatalf("nonce cookie = %+v", nonce)
+	}
+	if !strings.Contains(body, `name="nonce" value="`+nonce.Value+`"`) {
+		t.Errorf("form doesn't carry the nonce:\n%s", body)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/email/verify", nil))
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "http://frontend.test/?authError=invalid_link" {
+		t.Errorf("missing token: %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+// posts from another site don't have the nonce cookie, so they're turned away before the token is looked up
+func TestVerifyMagicLinkRequiresNonce(t *testing.T) {
+	t.Setenv("FRONTEND_URL", "http://frontend.test")
+	r := magicLinkRouter()
+
+	tests := []struct {
+		name   string
+		cookie string
+		form   url.Values
+	}{
+		{"no cookie", "", url.Values{"token": {"abc"}, "nonce": {"n1"}}},
+		{"wrong nonce", "n1", url.Values{"token": {"abc"}, "nonce": {"n2"}}},
+		{"no token", "n1", url.Values{"nonce": {"n1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/email/verify", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: magicLinkNonceCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			// a 303, so the browser doesn't replay the post against the frontend
+			if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "http://frontend.test/?authError=invalid_link" {
+				t.Errorf("got %d %s", w.Code, w.Header().Get("Location"))
+			}
+		})
+	}
+}
@@ -1,31 +1,34 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/id"
+	"good_morning_backend/internal/media"
 	"good_morning_backend/internal/models"
-	"good_morning_backend/internal/spotify"
-	"io"
+	"good_morning_backend/internal/music"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 const (
-	GoogleAuthURL     = "https://accounts.google.com/o/oauth2/auth"
-	GoogleTokenURL    = "https://oauth2.googleapis.com/token"
-	GoogleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
-	MaxFileSize       = 5 * 1024 * 1024 // 5mb
-	AllowedTypes      = "image/jpeg,image/png,image/webp"
+	MaxFileSize         = 20 * 1024 * 1024 // 20mb, matches the frontend limit
+	AllowedTypes        = "image/jpeg,image/png,image/webp,image/heic,image/heif"
+	MaxNoticePhotos     = 10
+	MaxCaptionLength    = 500
+	MaxLyricQuoteLength = 300
 )
 
 var (
@@ -33,23 +36,17 @@ var (
 	vapidPrivateKey string
 )
 
-type GoogleUser struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
-	Locale        string `json:"locale"`
-}
-
 func redirectToFrontend(c *gin.Context, path string) {
 	frontendURL := os.Getenv("FRONTEND_URL")
 	if frontendURL == "" {
 		frontendURL = "http://localhost:3000"
 	}
-	c.Redirect(http.StatusTemporaryRedirect, frontendURL+path)
+	// a 307 would replay a form post against the frontend
+	status := http.StatusTemporaryRedirect
+	if c.Request.Method != http.MethodGet {
+		status = http.StatusSeeOther
+	}
+	c.Redirect(status, frontendURL+path)
 }
 
 func generateState() string {
@@ -58,149 +55,6 @@ func generateState() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
-func handleGoogleLogin(c *gin.Context) {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	redirectURL := os.Getenv("GOOGLE_REDIRECT_URL")
-	state := generateState()
-
-	params := url.Values{}
-	params.Add("client_id", clientID)
-	params.Add("redirect_uri", redirectURL)
-	params.Add("scope", "openid email profile")
-	params.Add("response_type", "code")
-	params.Add("state", state)
-	params.Add("access_type", "offline")
-
-	authURL := GoogleAuthURL + "?" + params.Encode()
-	c.Redirect(http.StatusTemporaryRedirect, authURL)
-}
-
-func handleGoogleCallback(c *gin.Context) {
-	code := c.Query("code")
-
-	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "no authorization code"})
-		return
-	}
-
-	token, err := exchangeCodeForToken(code)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to exchange token"})
-		return
-	}
-
-	googleUser, err := getGoogleUserInfo(token.AccessToken)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user info"})
-		return
-	}
-
-	// check if user exists or create new
-	var user models.User
-	result := database.DB.Where("google_id = ?", googleUser.ID).First(&user)
-	if result.Error != nil {
-		if result.Error.Error() == "record not found" {
-			user = models.User{
-				ID:                   generateUserID(),
-				GoogleID:             googleUser.ID,
-				Email:                googleUser.Email,
-				Username:             googleUser.Name,
-				Timezone:             "UTC",
-				UniqueCode:           generateUniqueCode(),
-				NotificationsEnabled: false,
-				Picture:              &googleUser.Picture,
-			}
-			if err := database.DB.Create(&user).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
-				return
-			}
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "database error"})
-			return
-		}
-	}
-
-	// generate JWT and set in cookie
-	jwtToken, err := generateJWT(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate token"})
-		return
-	}
-
-	c.SetCookie("jwt", jwtToken, 86400, "/", "", false, true) // 24 hours, HTTP-only, secure if HTTPS
-
-	// redirect to frontend
-	redirectToFrontend(c, "/")
-}
-
-type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-}
-
-func exchangeCodeForToken(code string) (*TokenResponse, error) {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
-	clientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	redirectURL := os.Getenv("GOOGLE_REDIRECT_URL")
-
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("redirect_uri", redirectURL)
-	data.Set("grant_type", "authorization_code")
-
-	resp, err := http.PostForm(GoogleTokenURL, data)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var token TokenResponse
-	if err := json.Unmarshal(body, &token); err != nil {
-		return nil, err
-	}
-
-	return &token, nil
-}
-
-func getGoogleUserInfo(accessToken string) (*GoogleUser, error) {
-	req, err := http.NewRequest("GET", GoogleUserInfoURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var googleUser GoogleUser
-	if err := json.Unmarshal(body, &googleUser); err != nil {
-		return nil, err
-	}
-
-	return &googleUser, nil
-}
-
-func generateUserID() string {
-	return fmt.Sprintf("user_%d", time.Now().UnixNano())
-}
-
 func generateUniqueCode() string {
 	adjectives := []string{"brave", "clever", "swift", "mighty", "gentle", "wild", "fierce", "loyal", "playful", "wise", "mysterious", "ancient", "radiant", "shadowy", "vibrant", "ethereal", "noble", "savage", "serene", "thunderous"}
 	colors := []string{"red", "blue", "green", "yellow", "purple", "orange", "pink", "brown", "black", "white", "grey", "cyan", "magenta", "lime", "teal", "indigo", "violet", "gold", "silver", "bronze"}
@@ -213,14 +67,16 @@ func generateUniqueCode() string {
 	return adjective + "_" + color + "_" + animal
 }
 
-func generateJWT(userID string) (string, error) {
+// generateJWT issues a short-lived access token for a session; it's renewed with the session's refresh token
+func generateJWT(userID, sessionID string) (string, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		return "", fmt.Errorf("JWT_SECRET not set")
 	}
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"sid":     sessionID,
+		"exp":     time.Now().Add(AccessTokenTTL).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -229,6 +85,12 @@ func generateJWT(userID string) (string, error) {
 
 func authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// scripts authenticate with a personal API token instead of the browser session
+		if raw, ok := bearerToken(c); ok {
+			authenticateAPIToken(c, raw)
+			return
+		}
+
 		tokenString, err := c.Cookie("jwt")
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
@@ -256,14 +118,30 @@ func authMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := claims["user_id"].(string)
-			c.Set("user_id", userID)
-		} else {
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			c.Abort()
 			return
 		}
+		userID, _ := claims["user_id"].(string)
+		sessionID, _ := claims["sid"].(string)
+
+		// tokens from before sessions existed have no sid and can't be revoked, so they're no longer accepted
+		session, err := activeSession(sessionID, userID)
+		if err != nil {
+			if errors.Is(err, errSessionInvalid) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "server error"})
+			}
+			c.Abort()
+			return
+		}
+		touchSession(c, session)
+
+		c.Set("user_id", userID)
+		c.Set("session_id", sessionID)
 
 		c.Next()
 	}
@@ -410,6 +288,55 @@ func handleUserEdit(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "username updated successfully"})
 }
 
+// NoticeMediaInput references a photo from /media/photo by its id or url
+type NoticeMediaInput struct {
+	ID      string  `json:"id"`
+	URL     string  `json:"url"`
+	Caption *string `json:"caption"`
+}
+
+func handleUserMusicService(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var requestBody struct {
+		Service *string `json:"service"`
+	}
+
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+
+	// an empty service clears the preference
+	if requestBody.Service != nil && *requestBody.Service == "" {
+		requestBody.Service = nil
+	}
+	if requestBody.Service != nil {
+		if _, ok := music.DefaultRegistry().Get(*requestBody.Service); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown music service"})
+			return
+		}
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	user.PreferredMusicService = requestBody.Service
+	if err := database.DB.Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "music service updated successfully"})
+}
+
 func handleCreateNotice(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -428,13 +355,28 @@ func handleCreateNotice(c *gin.Context) {
 		return
 	}
 
+	var partner models.User
+	if err := database.DB.Where("id = ?", *user.PairedUserID).First(&partner).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get partner"})
+		return
+	}
+
+	if err := checkNoticeAllowed(&user, &partner); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	var requestBody struct {
-		Message         *string `json:"message"`
-		PhotoURL        *string `json:"photoUrl"`
-		SongURL         *string `json:"songUrl"`
-		SongExplanation *string `json:"songExplanation"`
-		ForegroundColor string  `json:"foregroundColor" binding:"required"`
-		BackgroundColor string  `json:"backgroundColor" binding:"required"`
+		Message         *string            `json:"message"`
+		PhotoURL        *string            `json:"photoUrl"`
+		Media           []NoticeMediaInput `json:"media"`
+		SongURL         *string            `json:"songUrl"`
+		SongExplanation *string            `json:"songExplanation"`
+		LyricQuote      *models.LyricQuote `json:"lyricQuote"`
+		VoiceNoteURL    *string            `json:"voiceNoteUrl"`
+		LinkURL         *string            `json:"linkUrl"`
+		ForegroundColor string             `json:"foregroundColor" binding:"required"`
+		BackgroundColor string             `json:"backgroundColor" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
@@ -442,27 +384,102 @@ func handleCreateNotice(c *gin.Context) {
 		return
 	}
 
-	var songTitle, songArtist, songAlbumCover *string
-	if requestBody.SongURL != nil && *requestBody.SongURL != "" {
-		trackID, err := spotify.ParseTrackID(*requestBody.SongURL)
-		if err == nil {
-			trackDetails, err := spotify.FetchTrackDetails(trackID)
-			if err == nil {
-				songTitle = &trackDetails.Title
-				songArtist = &trackDetails.Artist
-				songAlbumCover = &trackDetails.AlbumCover
-			} else {
-				log.Printf("failed to fetch Spotify track details: %v", err)
+	noticeID := id.New(id.Notice)
+
+	// older clients only send photoUrl, treat it as a single photo
+	if len(requestBody.Media) == 0 && requestBody.PhotoURL != nil && *requestBody.PhotoURL != "" {
+		requestBody.Media = append(requestBody.Media, NoticeMediaInput{URL: *requestBody.PhotoURL})
+	}
+
+	if len(requestBody.Media) > MaxNoticePhotos {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("too many photos (max %d)", MaxNoticePhotos)})
+		return
+	}
+
+	var attachedMediaIDs []string
+	seenMedia := make(map[string]bool, len(requestBody.Media))
+	noticeMedia := make([]models.NoticeMedia, 0, len(requestBody.Media))
+	for i, item := range requestBody.Media {
+		ref := item.ID
+		if ref == "" {
+			ref = item.URL
+		}
+		if ref == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "photo id or url is required"})
+			return
+		}
+		if item.Caption != nil && len([]rune(*item.Caption)) > MaxCaptionLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("caption too long (max %d characters)", MaxCaptionLength)})
+			return
+		}
+
+		photo, err := resolveOwnedMedia(user.ID, ref, MediaKindPhoto)
+		if err != nil {
+			if errors.Is(err, errMediaNotOwned) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "photos must be new uploads from good morning, each can only be sent once"})
+				return
 			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up photo"})
+			return
+		}
+		// the same upload can be referenced by id and by url, so compare what they resolved to
+		if seenMedia[photo.ID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the same photo can only be added to a notice once"})
+			return
+		}
+		seenMedia[photo.ID] = true
+
+		attachedMediaIDs = append(attachedMediaIDs, photo.ID)
+		noticeMedia = append(noticeMedia, models.NoticeMedia{
+			ID:       id.New(id.NoticeMedia),
+			NoticeID: noticeID,
+			MediaID:  photo.ID,
+			Position: i,
+			URL:      photo.URL,
+			Caption:  item.Caption,
+		})
+	}
+
+	if requestBody.LyricQuote != nil {
+		if err := validateLyricQuote(requestBody.LyricQuote, requestBody.SongURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if requestBody.LinkURL != nil {
+		trimmed := strings.TrimSpace(*requestBody.LinkURL)
+		if trimmed == "" {
+			requestBody.LinkURL = nil
+		} else if err := validateLinkURL(trimmed); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link: " + err.Error()})
+			return
 		} else {
-			log.Printf("failed to parse Spotify URL: %v", err)
+			requestBody.LinkURL = &trimmed
 		}
 	}
 
-	var partner models.User
-	if err := database.DB.Where("id = ?", *user.PairedUserID).First(&partner).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get partner"})
-		return
+	// keep photoUrl pointing at the first photo for the current frontend
+	var photoURL *string
+	if len(noticeMedia) > 0 {
+		photoURL = &noticeMedia[0].URL
+	}
+
+	var voiceNoteURL *string
+	var voiceNoteDuration *float64
+	if requestBody.VoiceNoteURL != nil && *requestBody.VoiceNoteURL != "" {
+		voiceNote, err := resolveOwnedMedia(user.ID, *requestBody.VoiceNoteURL, MediaKindVoice)
+		if err != nil {
+			if errors.Is(err, errMediaNotOwned) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "voice notes must be new uploads from good morning, each can only be sent once"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up voice note"})
+			return
+		}
+		attachedMediaIDs = append(attachedMediaIDs, voiceNote.ID)
+		voiceNoteURL = &voiceNote.URL
+		voiceNoteDuration = voiceNote.DurationSeconds
 	}
 
 	// resetAt is midnight in partner's timezone
@@ -476,28 +493,57 @@ func handleCreateNotice(c *gin.Context) {
 	resetAt := midnight
 
 	notice := models.Notice{
-		ID:              fmt.Sprintf("notice_%d", time.Now().UnixNano()),
-		SenderID:        user.ID,
-		RecipientID:     partner.ID,
-		Message:         requestBody.Message,
-		PhotoURL:        requestBody.PhotoURL,
-		SongURL:         requestBody.SongURL,
-		SongTitle:       songTitle,
-		SongArtist:      songArtist,
-		SongAlbumCover:  songAlbumCover,
-		SongExplanation: requestBody.SongExplanation,
-		ForegroundColor: requestBody.ForegroundColor,
-		BackgroundColor: requestBody.BackgroundColor,
-		Reactions:       []string{},
-		SentAt:          time.Now(),
-		ResetAt:         resetAt,
-	}
-
-	if err := database.DB.Create(&notice).Error; err != nil {
+		ID:                noticeID,
+		SenderID:          user.ID,
+		RecipientID:       partner.ID,
+		Message:           requestBody.Message,
+		PhotoURL:          photoURL,
+		SongURL:           requestBody.SongURL,
+		SongExplanation:   requestBody.SongExplanation,
+		LyricQuote:        requestBody.LyricQuote,
+		VoiceNoteURL:      voiceNoteURL,
+		VoiceNoteDuration: voiceNoteDuration,
+		LinkURL:           requestBody.LinkURL,
+		ForegroundColor:   requestBody.ForegroundColor,
+		BackgroundColor:   requestBody.BackgroundColor,
+		Reactions:         []string{},
+		SentAt:            time.Now(),
+		ResetAt:           resetAt,
+		Media:             noticeMedia,
+	}
+
+	// song details are looked up in the background, the client can show them as pending meanwhile
+	notice.MetadataStatus = MetadataStatusNone
+	if notice.SongURL != nil && *notice.SongURL != "" {
+		notice.MetadataStatus = MetadataStatusPending
+	}
+	notice.LinkStatus = MetadataStatusNone
+	if notice.LinkURL != nil {
+		notice.LinkStatus = MetadataStatusPending
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&notice).Error; err != nil {
+			return err
+		}
+		return attachMedia(tx, notice.ID, attachedMediaIDs)
+	})
+	if errors.Is(err, errMediaNotUnused) {
+		c.JSON(http.StatusConflict, gin.H{"error": "a photo or voice note is already used by another notice"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create notice"})
 		return
 	}
 
+	if notice.MetadataStatus == MetadataStatusPending {
+		enqueueNoticeMetadata(notice.ID)
+	}
+	if notice.LinkStatus == MetadataStatusPending {
+		enqueueNoticeLink(notice.ID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "notice created successfully"})
 }
 
@@ -516,7 +562,9 @@ func handleGetNotice(c *gin.Context) {
 
 	// find today's notice for the user
 	var notice models.Notice
-	if err := database.DB.Where("recipient_id = ? AND reset_at > ?", user.ID, time.Now()).Last(&notice).Error; err != nil {
+	if err := database.DB.Preload("Media", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Where("recipient_id = ? AND reset_at > ?", user.ID, time.Now()).Order("sent_at DESC").First(&notice).Error; err != nil {
 		if err.Error() == "record not found" {
 			c.JSON(http.StatusOK, gin.H{"notice": nil})
 			return
@@ -525,6 +573,13 @@ func handleGetNotice(c *gin.Context) {
 		return
 	}
 
+	notice.PreferredSongURL = notice.SongURL
+	if user.PreferredMusicService != nil {
+		if link, ok := notice.SongLinks[*user.PreferredMusicService]; ok {
+			notice.PreferredSongURL = &link
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"notice": notice})
 }
 
@@ -549,7 +604,7 @@ func handlePushSubscribe(c *gin.Context) {
 	database.DB.Where("user_id = ?", userID).Delete(&models.PushSubscription{})
 
 	subscription := models.PushSubscription{
-		ID:       fmt.Sprintf("sub_%d", time.Now().UnixNano()),
+		ID:       id.New(id.PushSub),
 		UserID:   userID.(string),
 		Endpoint: requestBody.Endpoint,
 		P256dh:   requestBody.P256dh,
@@ -604,7 +659,16 @@ func handlePushUnsubscribe(c *gin.Context) {
 
 func main() {
 	database.InitDB()
-	database.DB.AutoMigrate(&models.User{}, &models.Notice{}, &models.PushSubscription{})
+	database.DB.AutoMigrate(&models.User{}, &models.Notice{}, &models.NoticeMedia{}, &models.Media{}, &models.PushSubscription{}, &models.SpotifyAccount{}, &models.LinkPreview{}, &models.Session{}, &models.Identity{}, &models.LoginToken{}, &models.Credential{}, &models.WebAuthnChallenge{}, &models.APIToken{}, &models.RateLimitBucket{})
+	if err := migrateGoogleIdentities(); err != nil {
+		log.Fatal("failed to migrate google logins to identities:", err)
+	}
+	if err := media.InitStorage(); err != nil {
+		log.Fatal("failed to set up media storage: ", err)
+	}
+	media.StartGC(context.Background(), database.DB, media.GCConfigFromEnv())
+	startMetadataQueue(context.Background())
+	startAccountPurge(context.Background())
 
 	vapidPublicKey = os.Getenv("VAPID_PUBLIC_KEY")
 	vapidPrivateKey = os.Getenv("VAPID_PRIVATE_KEY")
@@ -614,13 +678,31 @@ func main() {
 
 	r := gin.Default()
 
+	// only believe X-Forwarded-For from our own proxies, or anyone could pick the IP they're rate limited as
+	var trustedProxies []string
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies = strings.Split(v, ",")
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("invalid TRUSTED_PROXIES:", err)
+	}
+	if len(trustedProxies) == 0 {
+		r.Use(warnUntrustedProxy())
+	}
+
 	// CORS middleware
 	config := cors.DefaultConfig()
 	frontendURL := os.Getenv("FRONTEND_URL")
 	config.AllowOrigins = []string{frontendURL}
 	config.AllowCredentials = true
+	config.AddAllowHeaders(csrfHeader)
 	r.Use(cors.New(config))
 
+	// serve locally stored uploads
+	if local, ok := media.Store.(*media.LocalStorage); ok {
+		r.Static("/media", local.Dir)
+	}
+
 	r.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "good morning! backend",
@@ -628,26 +710,51 @@ func main() {
 	})
 
 	// oauth routes
-	r.GET("/auth/google", handleGoogleLogin)
-	r.GET("/auth/google/callback", handleGoogleCallback)
-	r.GET("/logout", func(c *gin.Context) {
-		// clear JWT cookie
-		c.SetCookie("jwt", "", -1, "/", "", false, true)
-		redirectToFrontend(c, "/")
-	})
+	r.GET("/auth/:provider", rateLimit("auth"), handleProviderLogin)
+	r.GET("/auth/:provider/callback", rateLimit("auth"), handleProviderCallback)
+	r.POST("/auth/email", rateLimit("auth"), rateLimit("email"), handleRequestMagicLink)
+	r.GET("/auth/email/verify", rateLimit("auth"), handleMagicLinkPage)
+	r.POST("/auth/email/verify", rateLimit("auth"), handleVerifyMagicLink)
+	r.POST("/auth/passkey/begin", rateLimit("auth"), handleBeginPasskeyLogin)
+	r.POST("/auth/passkey/finish", rateLimit("auth"), handleFinishPasskeyLogin)
+	r.POST("/auth/refresh", rateLimit("auth"), handleRefreshSession)
+	r.GET("/logout", handleLogout)
 
 	// protected routes
 	protected := r.Group("/")
-	protected.Use(authMiddleware())
+	protected.Use(authMiddleware(), csrfMiddleware())
 	{
 		protected.GET("/me", handleGetMe)
-		protected.POST("/user/pair", handleUserPair)
+		protected.POST("/user/pair", rateLimit("pair"), handleUserPair)
 		protected.GET("/user/get", handleUserGet)
 		protected.PUT("/user/edit", handleUserEdit)
-		protected.POST("/notices/create", handleCreateNotice)
+		protected.PUT("/user/music-service", handleUserMusicService)
+		protected.DELETE("/user", handleDeleteAccount)
+		protected.POST("/user/cancel-deletion", handleCancelAccountDeletion)
+		protected.POST("/notices/create", rateLimit("notice"), handleCreateNotice)
 		protected.GET("/notices/get", handleGetNotice)
+		protected.GET("/songs/history", handleSongHistory)
+		protected.GET("/songs/export", handleSongExport)
+		protected.GET("/spotify/connect", handleSpotifyConnect)
+		protected.GET("/spotify/callback", handleSpotifyCallback)
+		protected.GET("/spotify/account", handleGetSpotifyAccount)
+		protected.DELETE("/spotify/account", handleDeleteSpotifyAccount)
+		protected.POST("/media/photo", handleUploadPhoto)
+		protected.POST("/media/voice", handleUploadVoiceNote)
 		protected.POST("/push/subscribe", handlePushSubscribe)
 		protected.DELETE("/push/unsubscribe", handlePushUnsubscribe)
+		protected.GET("/identities", handleListIdentities)
+		protected.POST("/identities/email", rateLimit("email"), handleRequestEmailLink)
+		protected.DELETE("/identities/:id", handleDeleteIdentity)
+		protected.GET("/passkeys", handleListPasskeys)
+		protected.POST("/passkeys/register/begin", handleBeginPasskeyRegistration)
+		protected.POST("/passkeys/register/finish", handleFinishPasskeyRegistration)
+		protected.DELETE("/passkeys/:id", handleDeletePasskey)
+		protected.GET("/tokens", handleListAPITokens)
+		protected.POST("/tokens", handleCreateAPIToken)
+		protected.DELETE("/tokens/:id", handleRevokeAPIToken)
+		protected.GET("/sessions", handleListSessions)
+		protected.DELETE("/sessions/:id", handleDeleteSession)
 	}
 
 	log.Fatal(r.Run(":24804"))
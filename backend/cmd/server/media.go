@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/id"
+	"good_morning_backend/internal/media"
+	"good_morning_backend/internal/models"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	MaxVoiceNoteSize     = 10 * 1024 * 1024 // 10mb
+	MaxVoiceNoteDuration = 2 * time.Minute
+
+	MediaKindPhoto = "photo"
+	MediaKindVoice = "voice"
+)
+
+var photoExts = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"image/heic": ".heic",
+	"image/heif": ".heif",
+}
+
+var (
+	errMediaNotOwned  = errors.New("media was not uploaded by this user")
+	errMediaNotUnused = errors.New("media is already attached to a notice or was removed")
+)
+
+func generateMediaKey(prefix, ext string) string {
+	return prefix + "/" + id.New("") + ext
+}
+
+// storeMedia uploads to storage and records who it was issued to, so notices can only reference our own uploads
+func storeMedia(c *gin.Context, ownerID, kind, key, contentType string, data []byte, duration *float64) (*models.Media, error) {
+	url, err := media.Store.Put(c.Request.Context(), key, contentType, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.Media{
+		ID:              id.New(id.Media),
+		OwnerID:         ownerID,
+		Kind:            kind,
+		Key:             key,
+		URL:             url,
+		ContentType:     contentType,
+		Size:            int64(len(data)),
+		DurationSeconds: duration,
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		media.Store.Delete(c.Request.Context(), key)
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// resolveOwnedMedia accepts either a media ID or the URL we issued for it; each upload can go on one notice only
+func resolveOwnedMedia(ownerID, ref, kind string) (*models.Media, error) {
+	var record models.Media
+	err := database.DB.Where("(id = ? OR url = ?) AND owner_id = ? AND kind = ? AND notice_id IS NULL", ref, ref, ownerID, kind).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errMediaNotOwned
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// attachMedia marks uploads as used by a notice so the orphan collector leaves them alone. It fails with
+// errMediaNotUnused if any of them was attached elsewhere or collected since it was resolved
+func attachMedia(tx *gorm.DB, noticeID string, mediaIDs []string) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+	result := tx.Model(&models.Media{}).Where("id IN ? AND notice_id IS NULL", mediaIDs).Updates(map[string]interface{}{
+		"notice_id":   noticeID,
+		"attached_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != int64(len(mediaIDs)) {
+		return errMediaNotUnused
+	}
+	return nil
+}
+
+func handleUploadPhoto(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxFileSize+1024*1024)
+	file, header, err := c.Request.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no image file provided"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > MaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file size exceeds limit"})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxFileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read image file"})
+		return
+	}
+	if len(data) > MaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file size exceeds limit"})
+		return
+	}
+
+	// trust the bytes, not the client's content type
+	contentType := media.SniffImage(data)
+	ext, ok := photoExts[contentType]
+	if !ok || !strings.Contains(AllowedTypes, contentType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid file type: %s", contentType)})
+		return
+	}
+
+	record, err := storeMedia(c, userID.(string), MediaKindPhoto, generateMediaKey("photos", ext), contentType, data, nil)
+	if err != nil {
+		log.Printf("failed to store photo: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store photo"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": record.ID, "url": record.URL})
+}
+
+func handleUploadVoiceNote(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxVoiceNoteSize+1024*1024)
+	file, header, err := c.Request.FormFile("audio")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no audio file provided"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > MaxVoiceNoteSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file size exceeds limit"})
+		return
+	}
+
+	contentType := strings.TrimSpace(strings.Split(header.Header.Get("Content-Type"), ";")[0])
+	if _, ok := media.AudioContentTypes[contentType]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid file type: %s", contentType)})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxVoiceNoteSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read audio file"})
+		return
+	}
+	if len(data) > MaxVoiceNoteSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file size exceeds limit"})
+		return
+	}
+
+	format, err := media.SniffAudio(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported audio format"})
+		return
+	}
+
+	duration, err := media.AudioDuration(format, data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "could not read audio duration"})
+		return
+	}
+	if duration <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "voice note is empty"})
+		return
+	}
+	if duration > MaxVoiceNoteDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("voice note too long (max %d seconds)", int(MaxVoiceNoteDuration.Seconds()))})
+		return
+	}
+
+	seconds := duration.Seconds()
+	record, err := storeMedia(c, userID.(string), MediaKindVoice, generateMediaKey("voice", format.Ext()), format.ContentType(), data, &seconds)
+	if err != nil {
+		log.Printf("failed to store voice note: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store voice note"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": record.ID, "url": record.URL, "duration": seconds})
+}
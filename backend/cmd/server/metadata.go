@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/jobs"
+	"good_morning_backend/internal/models"
+	"good_morning_backend/internal/music"
+	"good_morning_backend/internal/spotify"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+const (
+	MetadataStatusNone     = "none"
+	MetadataStatusPending  = "pending"
+	MetadataStatusResolved = "resolved"
+	MetadataStatusFailed   = "failed"
+)
+
+// songMetadataColumns are written by the resolver, so it never clobbers fields edited in the meantime
+var songMetadataColumns = []string{
+	"song_provider", "song_id", "song_kind", "song_links", "song_title", "song_artist", "song_artists", "song_album",
+	"song_album_cover", "song_images", "song_duration_ms", "song_explicit", "song_preview_url", "song_isrc", "lyric_quote", "metadata_status",
+}
+
+var metadataQueue *jobs.Queue
+
+// startMetadataQueue starts the workers and picks up notices left pending by a previous run
+func startMetadataQueue(ctx context.Context) {
+	metadataQueue = jobs.NewQueue(2, 6)
+	metadataQueue.Start(ctx)
+
+	var pending []models.Notice
+	if err := database.DB.Select("id").Where("metadata_status = ?", MetadataStatusPending).Find(&pending).Error; err != nil {
+		log.Printf("failed to load pending notices: %v", err)
+		return
+	}
+	for _, notice := range pending {
+		enqueueNoticeMetadata(notice.ID)
+	}
+
+	var pendingLinks []models.Notice
+	if err := database.DB.Select("id").Where("link_status = ?", MetadataStatusPending).Find(&pendingLinks).Error; err != nil {
+		log.Printf("failed to load pending link previews: %v", err)
+		return
+	}
+	for _, notice := range pendingLinks {
+		enqueueNoticeLink(notice.ID)
+	}
+}
+
+func enqueueNoticeMetadata(noticeID string) {
+	metadataQueue.Enqueue("metadata "+noticeID, func(ctx context.Context) error {
+		return resolveNoticeMetadata(ctx, noticeID)
+	}, func(err error) {
+		if err := database.DB.Model(&models.Notice{}).Where("id = ?", noticeID).Update("metadata_status", MetadataStatusFailed).Error; err != nil {
+			log.Printf("failed to mark notice %s metadata as failed: %v", noticeID, err)
+		}
+	})
+}
+
+func resolveNoticeMetadata(ctx context.Context, noticeID string) error {
+	var notice models.Notice
+	if err := database.DB.WithContext(ctx).Where("id = ?", noticeID).First(&notice).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	if notice.SongURL == nil || *notice.SongURL == "" {
+		return nil
+	}
+
+	registry := music.DefaultRegistry()
+	song, err := registry.Resolve(ctx, *notice.SongURL)
+	if err != nil {
+		// a link we can't parse won't start parsing on the next attempt
+		if errors.Is(err, music.ErrUnsupportedURL) || errors.Is(err, spotify.ErrInvalidURL) || errors.Is(err, spotify.ErrInvalidID) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+
+	applySongMetadata(&notice, song, registry.Equivalents(ctx, song))
+	clampLyricQuote(&notice)
+	notice.MetadataStatus = MetadataStatusResolved
+
+	if err := database.DB.WithContext(ctx).Model(&notice).Select(songMetadataColumns).Updates(&notice).Error; err != nil {
+		return err
+	}
+
+	// queued separately so a playlist failure retries without looking the song up again
+	metadataQueue.Enqueue("playlist "+noticeID, func(ctx context.Context) error {
+		return addToGoodMorningPlaylist(&notice)
+	}, nil)
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+)
+
+var errInvalidOAuthState = errors.New("invalid oauth state")
+
+// oauthState lives in a signed cookie between the login redirect and the callback
+type oauthState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Verifier string `json:"v"`
+	ReturnTo string `json:"r"`
+	Expires  int64  `json:"e"`
+}
+
+func oauthStateKey() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("JWT_SECRET not set")
+	}
+	// derived so a state signature can never be replayed as anything else signed with the secret
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("oauth-state"))
+	return mac.Sum(nil), nil
+}
+
+func signOAuthState(payload []byte) (string, error) {
+	key, err := oauthStateKey()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func setOAuthStateCookie(c *gin.Context, st *oauthState) error {
+	st.Expires = time.Now().Add(oauthStateTTL).Unix()
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	value, err := signOAuthState(payload)
+	if err != nil {
+		return err
+	}
+	setRedirectCookie(c, oauthStateCookie, value, int(oauthStateTTL.Seconds()), "/auth")
+	return nil
+}
+
+// consumeOAuthState verifies and clears the state cookie; it can only be used once
+func consumeOAuthState(c *gin.Context) (*oauthState, error) {
+	value, err := c.Cookie(oauthStateCookie)
+	setRedirectCookie(c, oauthStateCookie, "", -1, "/auth")
+	if err != nil {
+		return nil, errInvalidOAuthState
+	}
+
+	encodedPayload, encodedSig, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errInvalidOAuthState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, errInvalidOAuthState
+	}
+	expected, err := signOAuthState(payload)
+	if err != nil {
+		return nil, err
+	}
+	if _, expectedSig, _ := strings.Cut(expected, "."); !hmac.Equal([]byte(encodedSig), []byte(expectedSig)) {
+		return nil, errInvalidOAuthState
+	}
+
+	var st oauthState
+	if err := json.Unmarshal(payload, &st); err != nil {
+		return nil, errInvalidOAuthState
+	}
+	if time.Now().Unix() > st.Expires {
+		return nil, errInvalidOAuthState
+	}
+	if subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(st.State)) != 1 {
+		return nil, errInvalidOAuthState
+	}
+	return &st, nil
+}
+
+// generatePKCE returns an S256 code verifier and its challenge
+func generatePKCE() (string, string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	verifier := base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// sanitizeReturnPath only allows paths on the frontend, never another origin
+func sanitizeReturnPath(path string) string {
+	if path == "" || !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return path
+}
+
+// redirectWithAuthError sends the user back to the frontend with a code it can show, instead of a raw JSON error page
+func redirectWithAuthError(c *gin.Context, code string) {
+	redirectToFrontend(c, "/?authError="+url.QueryEscape(code))
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/id"
+	"good_morning_backend/internal/models"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+const (
+	PasskeyChallengeTTL    = 5 * time.Minute
+	MaxPasskeyNameLength   = 64
+	passkeyChallengeCookie = "webauthn_challenge"
+
+	challengeKindRegistration = "registration"
+	challengeKindLogin        = "login"
+)
+
+var errPasskeyCloned = errors.New("passkey sign count went backwards")
+
+var (
+	webAuthn     *webauthn.WebAuthn
+	webAuthnErr  error
+	webAuthnOnce sync.Once
+)
+
+// relyingParty is configured from WEBAUTHN_RP_ID and WEBAUTHN_RP_ORIGINS, defaulting to the frontend,
+// since that's the page the browser runs the ceremony on
+func relyingParty() (*webauthn.WebAuthn, error) {
+	webAuthnOnce.Do(func() {
+		frontendURL := os.Getenv("FRONTEND_URL")
+		if frontendURL == "" {
+			frontendURL = "http://localhost:3000"
+		}
+
+		rpID := os.Getenv("WEBAUTHN_RP_ID")
+		if rpID == "" {
+			if u, err := url.Parse(frontendURL); err == nil {
+				rpID = u.Hostname()
+			}
+		}
+		origins := []string{frontendURL}
+		if v := os.Getenv("WEBAUTHN_RP_ORIGINS"); v != "" {
+			origins = strings.Split(v, ",")
+		}
+
+		webAuthn, webAuthnErr = webauthn.New(&webauthn.Config{
+			RPID:          rpID,
+			RPDisplayName: "good morning!",
+			RPOrigins:     origins,
+			Timeouts: webauthn.TimeoutsConfig{
+				Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: PasskeyChallengeTTL, TimeoutUVD: PasskeyChallengeTTL},
+				Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: PasskeyChallengeTTL, TimeoutUVD: PasskeyChallengeTTL},
+			},
+		})
+	})
+	return webAuthn, webAuthnErr
+}
+
+// passkeyUser adapts a user and their stored credentials to what the webauthn library expects.
+// The user ID is the user handle: it's opaque and contains nothing personal
+type passkeyUser struct {
+	user        models.User
+	credentials []models.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(u.user.ID)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	if u.user.Email != "" {
+		return u.user.Email
+	}
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, cred := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, 0, len(cred.Transports))
+		for _, t := range cred.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              cred.CredentialID,
+			PublicKey:       cred.PublicKey,
+			AttestationType: cred.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserPresent:    true,
+				UserVerified:   cred.UserVerified,
+				BackupEligible: cred.BackupEligible,
+				BackupState:    cred.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    cred.AAGUID,
+				SignCount: cred.SignCount,
+			},
+		})
+	}
+	return credentials
+}
+
+func loadPasskeyUser(userID string) (*passkeyUser, error) {
+	u := &passkeyUser{}
+	if err := database.DB.Where("id = ?", userID).First(&u.user).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("user_id = ?", userID).Find(&u.credentials).Error; err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// saveChallenge stores the ceremony state server-side; the browser only holds its ID, in a cookie
+func saveChallenge(c *gin.Context, kind string, userID *string, sessionData *webauthn.SessionData) error {
+	// expired ceremonies are never finished, so clear them out as new ones start
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnChallenge{})
+
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return err
+	}
+	challenge := models.WebAuthnChallenge{
+		ID:        id.New(id.Challenge),
+		UserID:    userID,
+		Kind:      kind,
+		Data:      data,
+		ExpiresAt: time.Now().Add(PasskeyChallengeTTL),
+	}
+	if err := database.DB.Create(&challenge).Error; err != nil {
+		return err
+	}
+	setCookie(c, passkeyChallengeCookie, challenge.ID, int(PasskeyChallengeTTL.Seconds()), "/")
+	return nil
+}
+
+// consumeChallenge loads and deletes the ceremony state, so each challenge can only be answered once
+func consumeChallenge(c *gin.Context, kind string) (*models.WebAuthnChallenge, *webauthn.SessionData, error) {
+	challengeID, err := c.Cookie(passkeyChallengeCookie)
+	setCookie(c, passkeyChallengeCookie, "", -1, "/")
+	if err != nil {
+		return nil, nil, errors.New("no ceremony in progress")
+	}
+
+	var challenge models.WebAuthnChallenge
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND kind = ? AND expires_at > ?", challengeID, kind, time.Now()).First(&challenge).Error; err != nil {
+			return err
+		}
+		result := tx.Delete(&challenge)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if err != nil {
+		return nil, nil, errors.New("ceremony expired or already used")
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal(challenge.Data, &sessionData); err != nil {
+		return nil, nil, err
+	}
+	return &challenge, &sessionData, nil
+}
+
+func handleBeginPasskeyRegistration(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("webauthn config: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "passkeys are not available"})
+		return
+	}
+
+	user, err := loadPasskeyUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+		return
+	}
+
+	// discoverable credentials are what let the login page skip asking who you are
+	options, sessionData, err := rp.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+
+	if err := saveChallenge(c, challengeKindRegistration, &userID, sessionData); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// handleFinishPasskeyRegistration takes the authenticator's response as the body; the passkey's label is ?name=
+func handleFinishPasskeyRegistration(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	rp, err := relyingParty()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "passkeys are not available"})
+		return
+	}
+
+	challenge, sessionData, err := consumeChallenge(c, challengeKindRegistration)
+	if err != nil || challenge.UserID == nil || *challenge.UserID != userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "registration expired, please try again"})
+		return
+	}
+
+	user, err := loadPasskeyUser(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to find user"})
+		return
+	}
+
+	credential, err := rp.FinishRegistration(user, *sessionData, c.Request)
+	if err != nil {
+		log.Printf("passkey registration failed: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "passkey could not be verified"})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = describeDevice(c.Request.UserAgent())
+	}
+	if len([]rune(name)) > MaxPasskeyNameLength {
+		name = string([]rune(name)[:MaxPasskeyNameLength])
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+	stored := models.Credential{
+		ID:              id.New(id.Credential),
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+	}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"credential": stored})
+}
+
+func handleBeginPasskeyLogin(c *gin.Context) {
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("webauthn config: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "passkeys are not available"})
+		return
+	}
+
+	options, sessionData, err := rp.BeginDiscoverableLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	if err := saveChallenge(c, challengeKindLogin, nil, sessionData); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// verifyPasskeyLogin checks an assertion against the credentials of the user its user handle names. A counter
+// going backwards means the private key exists somewhere else too, so that fails with errPasskeyCloned
+func verifyPasskeyLogin(rp *webauthn.WebAuthn, sessionData *webauthn.SessionData, r *http.Request, lookup func(userID string) (*passkeyUser, error)) (*passkeyUser, *webauthn.Credential, error) {
+	var user *passkeyUser
+	_, credential, err := rp.FinishPasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		u, err := lookup(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		user = u
+		return u, nil
+	}, *sessionData, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if credential.Authenticator.CloneWarning {
+		return user, nil, errPasskeyCloned
+	}
+	return user, credential, nil
+}
+
+func handleFinishPasskeyLogin(c *gin.Context) {
+	rp, err := relyingParty()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "passkeys are not available"})
+		return
+	}
+
+	_, sessionData, err := consumeChallenge(c, challengeKindLogin)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "login expired, please try again"})
+		return
+	}
+
+	user, credential, err := verifyPasskeyLogin(rp, sessionData, c.Request, loadPasskeyUser)
+	if errors.Is(err, errPasskeyCloned) {
+		log.Printf("passkey login rejected: possible cloned authenticator for user %s", user.user.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "passkey could not be verified"})
+		return
+	}
+	if err != nil {
+		log.Printf("passkey login failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "passkey could not be verified"})
+		return
+	}
+
+	now := time.Now()
+	database.DB.Model(&models.Credential{}).
+		Where("user_id = ? AND credential_id = ?", user.user.ID, credential.ID).
+		Updates(map[string]interface{}{
+			"sign_count":    credential.Authenticator.SignCount,
+			"backup_state":  credential.Flags.BackupState,
+			"user_verified": credential.Flags.UserVerified,
+			"last_used_at":  now,
+		})
+
+	if err := startSession(c, user.user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to start session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "logged in"})
+}
+
+func handleListPasskeys(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var credentials []models.Credential
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passkeys": credentials})
+}
+
+// handleDeletePasskey removes a passkey, as long as it isn't the user's last way in
+func handleDeletePasskey(c *gin.Context) {
+	deleted, err := deleteLoginMethod(c.GetString("user_id"), c.Param("id"), &models.Credential{})
+	if errors.Is(err, errLastLoginMethod) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to remove passkey"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "passkey not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "passkey removed"})
+}
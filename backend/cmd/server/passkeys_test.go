@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/dbtest"
+	"good_morning_backend/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+func testRelyingParty(t *testing.T) *webauthn.WebAuthn {
+	rp, err := webauthn.New(&webauthn.Config{RPID: testRPID, RPDisplayName: "good morning!", RPOrigins: []string{testOrigin}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rp
+}
+
+// softAuthenticator holds a P-256 passkey and signs assertions with whatever counter it's told to
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialID := make([]byte, 16)
+	rand.Read(credentialID)
+	return &softAuthenticator{key: key, credentialID: credentialID}
+}
+
+// credential is what registration would have stored for this passkey
+func (a *softAuthenticator) credential(t *testing.T, userID string, signCount uint32) models.Credential {
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         int64(webauthncose.P256),
+		XCoord:        x,
+		YCoord:        y,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.Credential{
+		ID:              "cred_" + base64.RawURLEncoding.EncodeToString(a.credentialID),
+		UserID:          userID,
+		Name:            "test key",
+		CredentialID:    a.credentialID,
+		PublicKey:       publicKey,
+		AttestationType: "none",
+		SignCount:       signCount,
+		UserVerified:    true,
+	}
+}
+
+// assertion is the body a browser would post to finish a login
+func (a *softAuthenticator) assertion(t *testing.T, challenge, userID string, signCount uint32) *http.Request {
+	clientData, _ := json.Marshal(map[string]string{"type": "webauthn.get", "challenge": challenge, "origin": testOrigin})
+
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	authData := append(rpIDHash[:], byte(protocol.FlagUserPresent|protocol.FlagUserVerified))
+	authData = binary.BigEndian.AppendUint32(authData, signCount)
+
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encode := base64.RawURLEncoding.EncodeToString
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    encode(a.credentialID),
+		"rawId": encode(a.credentialID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode([]byte(userID)),
+		},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/auth/passkey/finish", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestVerifyPasskeyLogin(t *testing.T) {
+	rp := testRelyingParty(t)
+	key := newSoftAuthenticator(t)
+	users := map[string]*passkeyUser{
+		"user_a": {user: models.User{ID: "user_a", Username: "a"}, credentials: []models.Credential{key.credential(t, "user_a", 10)}},
+		"user_b": {user: models.User{ID: "user_b", Username: "b"}},
+	}
+	lookup := func(userID string) (*passkeyUser, error) {
+		if u, ok := users[userID]; ok {
+			return u, nil
+		}
+		return nil, errors.New("no such user")
+	}
+
+	tests := []struct {
+		name       string
+		userID     string
+		signCount  uint32
+		challenge  string // defaults to the session's
+		wantErr    bool
+		wantCloned bool
+	}{
+		{"counter moves forward", "user_a", 11, "", false, false},
+		{"counter replayed", "user_a", 10, "", true, true},
+		{"counter goes backwards", "user_a", 3, "", true, true},
+		{"counter reset to zero", "user_a", 0, "", true, true},
+		{"another challenge", "user_a", 11, "c29tZXRoaW5nIGVsc2U", true, false},
+		{"user handle of someone without the key", "user_b", 11, "", true, false},
+		{"unknown user handle", "user_c", 11, "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, session, err := rp.BeginDiscoverableLogin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			challenge := session.Challenge
+			if tt.challenge != "" {
+				challenge = tt.challenge
+			}
+
+			user, credential, err := verifyPasskeyLogin(rp, session, key.assertion(t, challenge, tt.userID, tt.signCount), lookup)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("login accepted")
+				}
+				if cloned := errors.Is(err, errPasskeyCloned); cloned != tt.wantCloned {
+					t.Errorf("err = %v, cloned = %v; want cloned = %v", err, cloned, tt.wantCloned)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyPasskeyLogin: %v", err)
+			}
+			if user.user.ID != tt.userID || credential.Authenticator.SignCount != tt.signCount {
+				t.Errorf("logged in %s with counter %d", user.user.ID, credential.Authenticator.SignCount)
+			}
+		})
+	}
+}
+
+// useTestDB points the handlers at a fresh schema for the length of the test
+func useTestDB(t *testing.T, tables ...interface{}) {
+	db := dbtest.Open(t, tables...)
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+// newPasskeyRouter serves the passkey routes with userID as the signed in user
+func newPasskeyRouter(userID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	signedIn := func(c *gin.Context) { c.Set("user_id", userID) }
+	r.POST("/passkeys/register/finish", signedIn, handleFinishPasskeyRegistration)
+	r.DELETE("/passkeys/:id", signedIn, handleDeletePasskey)
+	return r
+}
+
+// startCeremony saves a challenge the way the begin handlers do, returning its cookie
+func startCeremony(t *testing.T, kind string, userID *string) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	if err := saveChallenge(c, kind, userID, &webauthn.SessionData{Challenge: "challenge", Expires: time.Now().Add(PasskeyChallengeTTL)}); err != nil {
+		t.Fatalf("saveChallenge: %v", err)
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == passkeyChallengeCookie {
+			return cookie
+		}
+	}
+	t.Fatal("no challenge cookie set")
+	return nil
+}
+
+func finishCeremony(cookie *http.Cookie, kind string) error {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+	c.Request.AddCookie(cookie)
+	_, _, err := consumeChallenge(c, kind)
+	return err
+}
+
+func TestConsumeChallenge(t *testing.T) {
+	useTestDB(t, &models.WebAuthnChallenge{})
+
+	cookie := startCeremony(t, challengeKindLogin, nil)
+	if err := finishCeremony(cookie, challengeKindLogin); err != nil {
+		t.Fatalf("first answer: %v", err)
+	}
+	if err := finishCeremony(cookie, challengeKindLogin); err == nil {
+		t.Error("a challenge was answered twice")
+	}
+
+	cookie = startCeremony(t, challengeKindLogin, nil)
+	if err := finishCeremony(cookie, challengeKindRegistration); err == nil {
+		t.Error("a login challenge finished a registration")
+	}
+
+	cookie = startCeremony(t, challengeKindLogin, nil)
+	database.DB.Model(&models.WebAuthnChallenge{}).Where("id = ?", cookie.Value).Update("expires_at", time.Now().Add(-time.Second))
+	if err := finishCeremony(cookie, challengeKindLogin); err == nil {
+		t.Error("an expired challenge was accepted")
+	}
+
+	if err := finishCeremony(&http.Cookie{Name: passkeyChallengeCookie, Value: "chal_made_up"}, challengeKindLogin); err == nil {
+		t.Error("an unknown challenge was accepted")
+	}
+}
+
+func TestFinishRegistrationRejectsAnotherUsersChallenge(t *testing.T) {
+	useTestDB(t, &models.WebAuthnChallenge{}, &models.User{}, &models.Credential{})
+
+	userA := "user_a"
+	cookie := startCeremony(t, challengeKindRegistration, &userA)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/passkeys/register/finish", bytes.NewReader([]byte("{}")))
+	req.AddCookie(cookie)
+	newPasskeyRouter("user_b").ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("finishing someone else's registration = %d %s, want 400", w.Code, w.Body)
+	}
+
+	// the challenge is spent, so its owner has to start again rather than race the other user
+	if err := finishCeremony(cookie, challengeKindRegistration); err == nil {
+		t.Error("challenge still usable after a rejected attempt")
+	}
+}
+
+func TestDeletePasskeyOfAnotherUser(t *testing.T) {
+	useTestDB(t, &models.User{}, &models.Identity{}, &models.Credential{})
+
+	credentials := []models.Credential{
+		newSoftAuthenticator(t).credential(t, "user_a", 0),
+		newSoftAuthenticator(t).credential(t, "user_a", 0),
+		newSoftAuthenticator(t).credential(t, "user_b", 0),
+		newSoftAuthenticator(t).credential(t, "user_b", 0),
+	}
+	for _, u := range []models.User{{ID: "user_a"}, {ID: "user_b"}} {
+		if err := database.DB.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range credentials {
+		if err := database.DB.Create(&credentials[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	remove := func(asUser, credentialID string) int {
+		w := httptest.NewRecorder()
+		newPasskeyRouter(asUser).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/passkeys/"+credentialID, nil))
+		return w.Code
+	}
+
+	if code := remove("user_b", credentials[0].ID); code != http.StatusNotFound {
+		t.Errorf("deleting another user's passkey = %d, want 404", code)
+	}
+	var count int64
+	database.DB.Model(&models.Credential{}).Where("id = ?", credentials[0].ID).Count(&count)
+	if count != 1 {
+		t.Fatal("another user's passkey was deleted")
+	}
+
+	if code := remove("user_a", credentials[0].ID); code != http.StatusOK {
+		t.Errorf("deleting your own passkey = %d, want 200", code)
+	}
+	// the last passkey is the only way back in
+	if code := remove("user_a", credentials[1].ID); code != http.StatusConflict {
+		t.Errorf("deleting the last passkey = %d, want 409", code)
+	}
+}
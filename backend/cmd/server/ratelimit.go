@@ -0,0 +1,136 @@
+package main
+
+import (
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/ratelimit"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rateLimitPolicy limits a route group per client IP and, once authenticated, per user. PerRecipient is
+// checked by handlers that send email, keyed on the address, since rotating IPs shouldn't let anyone flood one inbox
+type rateLimitPolicy struct {
+	PerIP        ratelimit.Limit
+	PerUser      ratelimit.Limit
+	PerRecipient ratelimit.Limit
+}
+
+// defaultRateLimits are per route group; each can be overridden with RATE_LIMIT_<GROUP>_IP,
+// RATE_LIMIT_<GROUP>_USER and RATE_LIMIT_<GROUP>_RECIPIENT, e.g. RATE_LIMIT_PAIR_USER=5/10m, or "off"
+var defaultRateLimits = map[string]rateLimitPolicy{
+	// login redirects, callbacks, passkeys and session refresh
+	"auth": {PerIP: ratelimit.Every(30, time.Minute)},
+	// each magic link request sends an email
+	"email": {PerIP: ratelimit.Every(5, 10*time.Minute), PerRecipient: ratelimit.Every(3, 15*time.Minute)},
+	// pair codes are guessable, so attempts are kept well below what brute force would need
+	"pair":   {PerIP: ratelimit.Every(20, time.Hour), PerUser: ratelimit.Every(5, 10*time.Minute)},
+	"notice": {PerIP: ratelimit.Every(60, time.Hour), PerUser: ratelimit.Every(20, time.Hour)},
+}
+
+var (
+	rateLimitStore     ratelimit.Store
+	rateLimitStoreOnce sync.Once
+)
+
+// rateLimiter picks the store from RATE_LIMIT_BACKEND: memory (default) or postgres for multi-instance deployments
+func rateLimiter() ratelimit.Store {
+	rateLimitStoreOnce.Do(func() {
+		switch backend := os.Getenv("RATE_LIMIT_BACKEND"); backend {
+		case "postgres":
+			rateLimitStore = ratelimit.NewPostgresStore(database.DB)
+		case "", "memory":
+			rateLimitStore = ratelimit.NewMemoryStore()
+		default:
+			log.Printf("unknown RATE_LIMIT_BACKEND %q, using memory", backend)
+			rateLimitStore = ratelimit.NewMemoryStore()
+		}
+	})
+	return rateLimitStore
+}
+
+func rateLimitPolicyFor(group string) rateLimitPolicy {
+	policy := defaultRateLimits[group]
+	prefix := "RATE_LIMIT_" + strings.ToUpper(group)
+	override := func(name string, limit *ratelimit.Limit) {
+		v := os.Getenv(name)
+		if v == "" {
+			return
+		}
+		parsed, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			log.Printf("ignoring %s: %v", name, err)
+			return
+		}
+		*limit = parsed
+	}
+	override(prefix+"_IP", &policy.PerIP)
+	override(prefix+"_USER", &policy.PerUser)
+	override(prefix+"_RECIPIENT", &policy.PerRecipient)
+	return policy
+}
+
+// takeRateLimit takes a token from the bucket for key, answering 429 with Retry-After and aborting when it's
+// empty. If the store fails we let the request through rather than take the app down with it
+func takeRateLimit(c *gin.Context, key string, limit ratelimit.Limit) bool {
+	if !limit.Enabled() {
+		return true
+	}
+	allowed, wait, err := rateLimiter().Take(c.Request.Context(), key, limit)
+	if err != nil {
+		log.Printf("rate limit %s: %v", key, err)
+		return true
+	}
+	if !allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests, try again later"})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// rateLimitRecipient checks a group's per-recipient bucket for an already normalized email address
+func rateLimitRecipient(c *gin.Context, group, email string) bool {
+	return takeRateLimit(c, group+":recipient:"+email, rateLimitPolicyFor(group).PerRecipient)
+}
+
+// rateLimit answers 429 with Retry-After once a group's per-IP or per-user bucket is empty
+func rateLimit(group string) gin.HandlerFunc {
+	policy := rateLimitPolicyFor(group)
+
+	return func(c *gin.Context) {
+		if !takeRateLimit(c, group+":ip:"+c.ClientIP(), policy.PerIP) {
+			return
+		}
+		if userID := c.GetString("user_id"); userID != "" {
+			if !takeRateLimit(c, group+":user:"+userID, policy.PerUser) {
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// warnUntrustedProxy is used when TRUSTED_PROXIES is empty. It logs the first request that came through a proxy,
+// since every client then shares the proxy's IP and one busy user can get everyone rate limited
+func warnUntrustedProxy() gin.HandlerFunc {
+	var once sync.Once
+	return func(c *gin.Context) {
+		if c.GetHeader("X-Forwarded-For") != "" || c.GetHeader("X-Real-IP") != "" {
+			once.Do(func() {
+				log.Printf("WARNING: got a forwarded request from %s but TRUSTED_PROXIES is empty, so clients are "+
+					"rate limited by the proxy's IP; set TRUSTED_PROXIES to the proxy's address", c.RemoteIP())
+			})
+		}
+		c.Next()
+	}
+}
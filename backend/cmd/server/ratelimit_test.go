@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitRecipient(t *testing.T) {
+	t.Setenv("RATE_LIMIT_EMAIL_RECIPIENT", "2/1h")
+	gin.SetMode(gin.TestMode)
+
+	requests := 0
+	take := func(email string) *httptest.ResponseRecorder {
+		requests++
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/auth/email", nil)
+		// every request from a new IP, so only the recipient bucket can stop them
+		c.Request.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", requests)
+		rateLimitRecipient(c, "email", email)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := take("flooded@example.com"); w.Code != http.StatusOK {
+			t.Fatalf("request %d limited: %d", i+1, w.Code)
+		}
+	}
+	w := take("flooded@example.com")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("third email to one address = %d, Retry-After %q; want 429", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := take("someone-else@example.com"); w.Code != http.StatusOK {
+		t.Errorf("another address was limited: %d", w.Code)
+	}
+}
+
+func TestWarnUntrustedProxy(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(warnUntrustedProxy())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	request := func(forwardedFor string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.5:41000"
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request was stopped: %d", w.Code)
+		}
+	}
+
+	request("")
+	if logs.Len() != 0 {
+		t.Fatalf("warned about a direct request: %s", logs.String())
+	}
+	request("203.0.113.7")
+	request("198.51.100.2")
+	if got := strings.Count(logs.String(), "TRUSTED_PROXIES is empty"); got != 1 {
+		t.Errorf("warned %d times, want once:\n%s", got, logs.String())
+	}
+	if !strings.Contains(logs.String(), "10.0.0.5") {
+		t.Errorf("warning doesn't name the proxy: %s", logs.String())
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/id"
+	"good_morning_backend/internal/models"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	AccessTokenTTL = 15 * time.Minute
+	SessionTTL     = 30 * 24 * time.Hour
+
+	refreshCookie     = "refresh_token"
+	refreshCookiePath = "/auth"
+	// a second tab refreshing with the token another tab just rotated isn't theft
+	refreshReuseGrace = 30 * time.Second
+	// how stale LastSeenAt can get before a request bumps it, so we don't write on every request
+	lastSeenInterval = 5 * time.Minute
+)
+
+var errSessionInvalid = errors.New("session revoked or expired")
+
+// hashToken is how bearer secrets are stored, so a database leak doesn't leak usable tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshToken returns the cookie value, "<session id>.<secret>", and the hash of the secret
+func newRefreshToken(sessionID string) (string, string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	return sessionID + "." + secret, hashToken(secret)
+}
+
+func parseRefreshToken(token string) (string, string, bool) {
+	sessionID, secret, ok := strings.Cut(token, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", "", false
+	}
+	return sessionID, secret, true
+}
+
+// describeDevice turns a user agent into something a person recognises in a list of sessions
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "firefox/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad"):
+		platform = "iOS"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "mac os"):
+		platform = "macOS"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	if platform == "" {
+		return browser
+	}
+	return browser + " on " + platform
+}
+
+// startSession records a new signed-in device and sets its access and refresh cookies
+func startSession(c *gin.Context, userID string) error {
+	now := time.Now()
+	session := models.Session{
+		ID:         id.New(id.Session),
+		UserID:     userID,
+		Device:     describeDevice(c.Request.UserAgent()),
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		LastSeenAt: now,
+		RotatedAt:  now,
+		ExpiresAt:  now.Add(SessionTTL),
+	}
+	refreshToken, refreshHash := newRefreshToken(session.ID)
+	session.RefreshTokenHash = refreshHash
+
+	if err := database.DB.Create(&session).Error; err != nil {
+		return err
+	}
+	return setSessionCookies(c, &session, refreshToken)
+}
+
+func setSessionCookies(c *gin.Context, session *models.Session, refreshToken string) error {
+	accessToken, err := generateJWT(session.UserID, session.ID)
+	if err != nil {
+		return err
+	}
+	maxAge := int(time.Until(session.ExpiresAt).Seconds())
+	setCookie(c, "jwt", accessToken, int(AccessTokenTTL.Seconds()), "/")
+	setCookie(c, refreshCookie, refreshToken, maxAge, refreshCookiePath)
+	setCSRFCookie(c, session.ID, maxAge)
+	return nil
+}
+
+func clearSessionCookies(c *gin.Context) {
+	setCookie(c, "jwt", "", -1, "/")
+	setCookie(c, refreshCookie, "", -1, refreshCookiePath)
+	writeCookie(c, csrfCookie, "", -1, "/", false, cookieConfigFromEnv().SameSite)
+}
+
+// activeSession loads a session that hasn't been revoked or expired
+func activeSession(sessionID, userID string) (*models.Session, error) {
+	var session models.Session
+	err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errSessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func touchSession(c *gin.Context, session *models.Session) {
+	if time.Since(session.LastSeenAt) < lastSeenInterval {
+		return
+	}
+	database.DB.Model(session).Updates(map[string]interface{}{
+		"last_seen_at": time.Now(),
+		"ip":           c.ClientIP(),
+	})
+}
+
+func revokeSession(sessionID string) error {
+	return database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// handleRefreshSession rotates the refresh token and issues a new access token
+func handleRefreshSession(c *gin.Context) {
+	token, err := c.Cookie(refreshCookie)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	sessionID, secret, ok := parseRefreshToken(token)
+	if !ok {
+		clearSessionCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var session models.Session
+	err = database.DB.Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).First(&session).Error
+	if err != nil {
+		clearSessionCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	presented := hashToken(secret)
+	if presented != session.RefreshTokenHash {
+		if session.PreviousRefreshHash != nil && presented == *session.PreviousRefreshHash {
+			if time.Since(session.RotatedAt) < refreshReuseGrace {
+				// lost a race with another tab; its new cookie is already in the jar
+				c.JSON(http.StatusConflict, gin.H{"error": "refresh already in progress"})
+				return
+			}
+			// an old refresh token coming back means it was copied; end the session for everyone holding it
+			revokeSession(session.ID)
+		}
+		clearSessionCookies(c)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	now := time.Now()
+	refreshToken, refreshHash := newRefreshToken(session.ID)
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":    refreshHash,
+			"previous_refresh_hash": session.RefreshTokenHash,
+			"rotated_at":            now,
+			"last_seen_at":          now,
+			"ip":                    c.ClientIP(),
+			"expires_at":            now.Add(SessionTTL),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "refresh already in progress"})
+		return
+	}
+
+	session.ExpiresAt = now.Add(SessionTTL)
+	if err := setSessionCookies(c, &session, refreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session refreshed"})
+}
+
+// sessionIDFromCookie reads the session out of the access token without requiring it to be unexpired
+func sessionIDFromCookie(c *gin.Context) string {
+	tokenString, err := c.Cookie("jwt")
+	if err != nil {
+		return ""
+	}
+	secret := os.Getenv("JWT_SECRET")
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256"}), jwt.WithoutClaimsValidation())
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	if err != nil || secret == "" {
+		return ""
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	sessionID, _ := claims["sid"].(string)
+	return sessionID
+}
+
+func handleLogout(c *gin.Context) {
+	if sessionID := sessionIDFromCookie(c); sessionID != "" {
+		revokeSession(sessionID)
+	}
+	clearSessionCookies(c)
+	redirectToFrontend(c, "/")
+}
+
+func handleListSessions(c *gin.Context) {
+	userID := c.GetString("user_id")
+
+	var sessions []models.Session
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get sessions"})
+		return
+	}
+
+	type sessionResponse struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+	current := c.GetString("session_id")
+	response := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, sessionResponse{Session: s, Current: s.ID == current})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+func handleDeleteSession(c *gin.Context) {
+	userID := c.GetString("user_id")
+	sessionID := c.Param("id")
+
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke session"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if sessionID == c.GetString("session_id") {
+		clearSessionCookies(c)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
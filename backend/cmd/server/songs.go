@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/models"
+	"good_morning_backend/internal/music"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// optionalString keeps empty metadata out of the notice instead of storing ""
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func validateLyricQuote(quote *models.LyricQuote, songURL *string) error {
+	if songURL == nil || *songURL == "" {
+		return errors.New("a lyric quote needs a song")
+	}
+	quote.Text = strings.TrimSpace(quote.Text)
+	if quote.Text == "" {
+		return errors.New("lyric quote text is required")
+	}
+	if utf8.RuneCountInString(quote.Text) > MaxLyricQuoteLength {
+		return fmt.Errorf("lyric quote too long (max %d characters)", MaxLyricQuoteLength)
+	}
+	if quote.TimestampMs != nil && *quote.TimestampMs < 0 {
+		return errors.New("lyric quote timestamp must not be negative")
+	}
+	return nil
+}
+
+// clampLyricQuote pulls a timestamp past the end of the track back to the end; the duration is only known once
+// the metadata job has looked the song up, after the notice was accepted
+func clampLyricQuote(notice *models.Notice) {
+	quote := notice.LyricQuote
+	if quote == nil || quote.TimestampMs == nil || notice.SongDurationMs == nil {
+		return
+	}
+	if *quote.TimestampMs > *notice.SongDurationMs {
+		log.Printf("notice %s lyric timestamp %dms is past the end of the track (%dms), clamping it", notice.ID, *quote.TimestampMs, *notice.SongDurationMs)
+		end := *notice.SongDurationMs
+		quote.TimestampMs = &end
+	}
+}
+
+func applySongMetadata(notice *models.Notice, song *music.Metadata, links map[string]string) {
+	notice.SongProvider = optionalString(song.Provider)
+	notice.SongID = optionalString(song.ID)
+	notice.SongKind = optionalString(song.Kind)
+	notice.SongTitle = optionalString(song.Title)
+	notice.SongArtist = optionalString(song.Artist)
+	notice.SongArtists = song.Artists
+	notice.SongAlbum = optionalString(song.Album)
+	notice.SongAlbumCover = optionalString(song.AlbumCover)
+	notice.SongPreviewURL = optionalString(song.PreviewURL)
+	notice.SongISRC = optionalString(song.ISRC)
+	notice.SongLinks = links
+
+	notice.SongImages = nil
+	for _, image := range song.Images {
+		notice.SongImages = append(notice.SongImages, models.SongImage{URL: image.URL, Width: image.Width, Height: image.Height})
+	}
+
+	notice.SongDurationMs = nil
+	if song.DurationMs > 0 {
+		duration := song.DurationMs
+		notice.SongDurationMs = &duration
+	}
+	explicit := song.Explicit
+	notice.SongExplicit = &explicit
+}
+
+type SongHistoryEntry struct {
+	Provider    *string           `json:"provider"`
+	ID          *string           `json:"id"`
+	Kind        *string           `json:"kind"`
+	URL         string            `json:"url"`
+	Title       *string           `json:"title"`
+	Artist      *string           `json:"artist"`
+	Artists     []string          `json:"artists"`
+	Album       *string           `json:"album"`
+	AlbumCover  *string           `json:"albumCover"`
+	DurationMs  *int              `json:"durationMs"`
+	ISRC        *string           `json:"isrc"`
+	Links       map[string]string `json:"links"`
+	Count       int               `json:"count"`
+	FirstSentAt time.Time         `json:"firstSentAt"`
+	LastSentAt  time.Time         `json:"lastSentAt"`
+	FirstSentBy string            `json:"firstSentBy"`
+}
+
+// songKeys identify a song across notices. The ISRC comes first, so the same recording sent from different
+// services is one song; the provider's ID (or, for unresolved links, the URL) also matches notices from
+// before the ISRC was known
+func songKeys(notice *models.Notice) []string {
+	var keys []string
+	if notice.SongISRC != nil && *notice.SongISRC != "" {
+		keys = append(keys, "isrc:"+strings.ToUpper(*notice.SongISRC))
+	}
+	if notice.SongProvider != nil && notice.SongID != nil {
+		kind := music.KindTrack
+		if notice.SongKind != nil {
+			kind = *notice.SongKind
+		}
+		return append(keys, *notice.SongProvider+":"+kind+":"+*notice.SongID)
+	}
+	return append(keys, *notice.SongURL)
+}
+
+// pairSongHistory returns every song exchanged between the user and their partner, oldest first
+func pairSongHistory(userID, partnerID string) ([]*SongHistoryEntry, error) {
+	var notices []models.Notice
+	err := database.DB.
+		Where("((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)) AND song_url IS NOT NULL AND song_url <> ''", userID, partnerID, partnerID, userID).
+		Order("sent_at").
+		Find(&notices).Error
+	if err != nil {
+		return nil, err
+	}
+	return songHistory(notices), nil
+}
+
+// songHistory groups notices, oldest first, into one entry per song
+func songHistory(notices []models.Notice) []*SongHistoryEntry {
+	var history []*SongHistoryEntry
+	byKey := map[string]*SongHistoryEntry{}
+	for i := range notices {
+		notice := &notices[i]
+		keys := songKeys(notice)
+
+		var entry *SongHistoryEntry
+		for _, key := range keys {
+			if entry = byKey[key]; entry != nil {
+				break
+			}
+		}
+		if entry == nil {
+			entry = &SongHistoryEntry{
+				Provider:    notice.SongProvider,
+				ID:          notice.SongID,
+				Kind:        notice.SongKind,
+				URL:         *notice.SongURL,
+				FirstSentAt: notice.SentAt,
+				FirstSentBy: notice.SenderID,
+			}
+			history = append(history, entry)
+		}
+		for _, key := range keys {
+			byKey[key] = entry
+		}
+
+		// later notices may have resolved metadata the first one didn't
+		if notice.SongTitle != nil {
+			entry.Title = notice.SongTitle
+			entry.Artist = notice.SongArtist
+			entry.Artists = notice.SongArtists
+			entry.Album = notice.SongAlbum
+			entry.AlbumCover = notice.SongAlbumCover
+			entry.DurationMs = notice.SongDurationMs
+			entry.ISRC = notice.SongISRC
+			entry.Links = notice.SongLinks
+		}
+		entry.Count++
+		entry.LastSentAt = notice.SentAt
+	}
+	return history
+}
+
+func loadPair(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ?", userID).First(&user).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return nil, false
+	}
+
+	if user.PairedUserID == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no paired user"})
+		return nil, false
+	}
+
+	return &user, true
+}
+
+func handleSongHistory(c *gin.Context) {
+	user, ok := loadPair(c)
+	if !ok {
+		return
+	}
+
+	history, err := pairSongHistory(user.ID, *user.PairedUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get song history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"songs": history, "total": len(history)})
+}
+
+func handleSongExport(c *gin.Context) {
+	user, ok := loadPair(c)
+	if !ok {
+		return
+	}
+
+	history, err := pairSongHistory(user.ID, *user.PairedUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get song history"})
+		return
+	}
+	writeSongExport(c, history)
+}
+
+// writeSongExport answers with the history in the format the query asks for, m3u by default
+func writeSongExport(c *gin.Context, history []*SongHistoryEntry) {
+	format := c.DefaultQuery("format", "m3u")
+	switch format {
+	case "m3u":
+		c.Header("Content-Disposition", `attachment; filename="our-songs.m3u"`)
+		c.Data(http.StatusOK, "audio/x-mpegurl; charset=utf-8", exportM3U(history))
+	case "xspf":
+		body, err := exportXSPF(history)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export playlist"})
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="our-songs.xspf"`)
+		c.Data(http.StatusOK, "application/xspf+xml; charset=utf-8", body)
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="our-songs.json"`)
+		c.JSON(http.StatusOK, exportJSON(history))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of m3u, xspf, json"})
+	}
+}
+
+func songLabel(entry *SongHistoryEntry) string {
+	title := entry.URL
+	if entry.Title != nil {
+		title = *entry.Title
+	}
+	if entry.Artist != nil && *entry.Artist != "" {
+		return *entry.Artist + " - " + title
+	}
+	return title
+}
+
+func exportM3U(history []*SongHistoryEntry) []byte {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#PLAYLIST:our songs\n")
+	for _, entry := range history {
+		seconds := -1
+		if entry.DurationMs != nil {
+			seconds = *entry.DurationMs / 1000
+		}
+		// newlines would break the entry onto a line players read as a path
+		label := strings.NewReplacer("\r", " ", "\n", " ").Replace(songLabel(entry))
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n%s\n", seconds, label, entry.URL)
+	}
+	return []byte(b.String())
+}
+
+type xspfPlaylist struct {
+	XMLName   xml.Name    `xml:"playlist"`
+	Version   string      `xml:"version,attr"`
+	Namespace string      `xml:"xmlns,attr"`
+	Title     string      `xml:"title"`
+	Tracks    []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Identifier string `xml:"identifier,omitempty"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	Duration   int    `xml:"duration,omitempty"`
+	Image      string `xml:"image,omitempty"`
+}
+
+func exportXSPF(history []*SongHistoryEntry) ([]byte, error) {
+	playlist := xspfPlaylist{
+		Version:   "1",
+		Namespace: "http://xspf.org/ns/0/",
+		Title:     "our songs",
+	}
+	for _, entry := range history {
+		track := xspfTrack{Location: entry.URL}
+		if entry.ISRC != nil {
+			track.Identifier = "isrc:" + *entry.ISRC
+		}
+		if entry.Title != nil {
+			track.Title = *entry.Title
+		}
+		if entry.Artist != nil {
+			track.Creator = *entry.Artist
+		}
+		if entry.Album != nil {
+			track.Album = *entry.Album
+		}
+		if entry.DurationMs != nil {
+			track.Duration = *entry.DurationMs
+		}
+		if entry.AlbumCover != nil {
+			track.Image = *entry.AlbumCover
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+
+	body, err := xml.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+type songExportTrack struct {
+	Title      string            `json:"title"`
+	Artists    []string          `json:"artists"`
+	Album      string            `json:"album,omitempty"`
+	ISRC       string            `json:"isrc,omitempty"`
+	DurationMs int               `json:"durationMs,omitempty"`
+	URL        string            `json:"url"`
+	Links      map[string]string `json:"links,omitempty"`
+	Count      int               `json:"count"`
+	AddedAt    time.Time         `json:"addedAt"`
+}
+
+// exportJSON uses the title/artists/album/isrc shape playlist transfer tools match on
+func exportJSON(history []*SongHistoryEntry) gin.H {
+	tracks := make([]songExportTrack, 0, len(history))
+	for _, entry := range history {
+		// only tracks can be added to a playlist
+		if entry.Kind != nil && *entry.Kind != music.KindTrack {
+			continue
+		}
+		track := songExportTrack{
+			Artists: entry.Artists,
+			URL:     entry.URL,
+			Links:   entry.Links,
+			Count:   entry.Count,
+			AddedAt: entry.FirstSentAt,
+		}
+		if entry.Title != nil {
+			track.Title = *entry.Title
+		}
+		if entry.Album != nil {
+			track.Album = *entry.Album
+		}
+		if entry.ISRC != nil {
+			track.ISRC = *entry.ISRC
+		}
+		if entry.DurationMs != nil {
+			track.DurationMs = *entry.DurationMs
+		}
+		tracks = append(tracks, track)
+	}
+	return gin.H{"name": "our songs", "tracks": tracks}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"good_morning_backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestClampLyricQuote(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp *int
+		duration  *int
+		want      *int
+	}{
+		{"within the track", intPtr(60000), intPtr(200000), intPtr(60000)},
+		{"at the very end", intPtr(200000), intPtr(200000), intPtr(200000)},
+		{"past the end", intPtr(250000), intPtr(200000), intPtr(200000)},
+		{"duration unknown", intPtr(250000), nil, intPtr(250000)},
+		{"no timestamp", nil, intPtr(200000), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notice := models.Notice{ID: "notice_1", SongDurationMs: tt.duration, LyricQuote: &models.LyricQuote{Text: "good morning", TimestampMs: tt.timestamp}}
+			clampLyricQuote(&notice)
+			got := notice.LyricQuote.TimestampMs
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("timestamp = %v, want %v", got, tt.want)
+			}
+			if notice.LyricQuote.Text != "good morning" {
+				t.Errorf("text changed to %q", notice.LyricQuote.Text)
+			}
+		})
+	}
+
+	// a notice without a quote is left alone
+	notice := models.Notice{SongDurationMs: intPtr(1000)}
+	clampLyricQuote(&notice)
+	if notice.LyricQuote != nil {
+		t.Error("clampLyricQuote added a quote")
+	}
+}
+
+func TestValidateLyricQuote(t *testing.T) {
+	song := "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC"
+	long := make([]rune, MaxLyricQuoteLength+1)
+	for i := range long {
+		long[i] = 'a'
+	}
+	tests := []struct {
+		name    string
+		quote   models.LyricQuote
+		songURL *string
+		wantErr bool
+	}{
+		{"valid", models.LyricQuote{Text: "  here comes the sun  ", TimestampMs: intPtr(0)}, &song, false},
+		{"no song", models.LyricQuote{Text: "here comes the sun"}, nil, true},
+		{"blank text", models.LyricQuote{Text: "   "}, &song, true},
+		{"too long", models.LyricQuote{Text: string(long)}, &song, true},
+		{"negative timestamp", models.LyricQuote{Text: "here comes the sun", TimestampMs: intPtr(-1)}, &song, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateLyricQuote(&tt.quote, tt.songURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateLyricQuote = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.quote.Text != "here comes the sun" {
+				t.Errorf("text wasn't trimmed: %q", tt.quote.Text)
+			}
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
+
+// songNotice is a notice whose song metadata has been resolved
+func songNotice(sender string, sentAt time.Time, provider, songID, url, isrc string) models.Notice {
+	notice := models.Notice{
+		SenderID:     sender,
+		SentAt:       sentAt,
+		SongURL:      strPtr(url),
+		SongProvider: strPtr(provider),
+		SongID:       strPtr(songID),
+		SongKind:     strPtr("track"),
+		SongTitle:    strPtr("Here Comes The Sun"),
+		SongArtist:   strPtr("The Beatles"),
+		SongArtists:  []string{"The Beatles"},
+	}
+	if isrc != "" {
+		notice.SongISRC = strPtr(isrc)
+	}
+	return notice
+}
+
+func TestSongHistoryDedup(t *testing.T) {
+	day := time.Date(2025, 3, 1, 7, 0, 0, 0, time.UTC)
+	spotifyURL := "https://open.spotify.com/track/6dGnYIeXmHdcikdzNNDMm2"
+	deezerURL := "https://www.deezer.com/track/116348128"
+
+	pending := models.Notice{SenderID: "user_b", SentAt: day.Add(48 * time.Hour), SongURL: strPtr(spotifyURL), SongProvider: strPtr("spotify"), SongID: strPtr("6dGnYIeXmHdcikdzNNDMm2")}
+	unresolved := models.Notice{SenderID: "user_a", SentAt: day.Add(72 * time.Hour), SongURL: strPtr("https://example.com/song")}
+	other := songNotice("user_b", day.Add(96*time.Hour), "spotify", "0aym2LBJBk9DAYuHHutrIl", "https://open.spotify.com/track/0aym2LBJBk9DAYuHHutrIl", "GBAYE0601477")
+	other.SongTitle = strPtr("Hey Jude")
+
+	history := songHistory([]models.Notice{
+		songNotice("user_a", day, "spotify", "6dGnYIeXmHdcikdzNNDMm2", spotifyURL, "GBAYE0601690"),
+		// the same recording from another service, with a lower-case ISRC
+		songNotice("user_b", day.Add(24*time.Hour), "deezer", "116348128", deezerURL, "gbaye0601690"),
+		// metadata not looked up yet, so no ISRC; the Spotify ID still matches
+		pending,
+		unresolved,
+		other,
+		unresolved,
+	})
+
+	if len(history) != 3 {
+		for _, entry := range history {
+			t.Logf("%s x%d", entry.URL, entry.Count)
+		}
+		t.Fatalf("got %d songs, want 3", len(history))
+	}
+	sun := history[0]
+	if sun.Count != 3 || sun.URL != spotifyURL || sun.FirstSentBy != "user_a" || !sun.FirstSentAt.Equal(day) || !sun.LastSentAt.Equal(day.Add(48*time.Hour)) {
+		t.Errorf("first song = %+v", *sun)
+	}
+	if sun.Title == nil || *sun.Title != "Here Comes The Sun" {
+		t.Errorf("pending notice wiped the resolved title: %v", sun.Title)
+	}
+	if history[1].URL != "https://example.com/song" || history[1].Count != 2 {
+		t.Errorf("unresolved link = %+v", *history[1])
+	}
+	if history[2].Title == nil || *history[2].Title != "Hey Jude" || history[2].Count != 1 {
+		t.Errorf("third song = %+v", *history[2])
+	}
+}
+
+func exportHistory() []*SongHistoryEntry {
+	added := time.Date(2025, 3, 1, 7, 0, 0, 0, time.UTC)
+	return []*SongHistoryEntry{
+		{
+			Kind: strPtr("track"), URL: "https://open.spotify.com/track/6dGnYIeXmHdcikdzNNDMm2",
+			Title: strPtr("Here Comes The Sun"), Artist: strPtr("The Beatles"), Artists: []string{"The Beatles"},
+			Album: strPtr("Abbey Road"), AlbumCover: strPtr("https://i.scdn.co/image/abbey"), DurationMs: intPtr(185733),
+			ISRC: strPtr("GBAYE0601690"), Links: map[string]string{"deezer": "https://www.deezer.com/track/116348128"},
+			Count: 3, FirstSentAt: added,
+		},
+		{Kind: strPtr("album"), URL: "https://open.spotify.com/album/0ETFjACtuP2ADo6LFhL6HN", Title: strPtr("Abbey Road"), Count: 1, FirstSentAt: added},
+		{URL: "https://example.com/song", Title: strPtr("Line one\nline two"), Count: 1, FirstSentAt: added},
+	}
+}
+
+func exportRequest(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/songs/export", func(c *gin.Context) { writeSongExport(c, exportHistory()) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/songs/export"+query, nil))
+	return w
+}
+
+func TestSongExportM3U(t *testing.T) {
+	for _, query := range []string{"", "?format=m3u"} {
+		w := exportRequest(t, query)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "audio/x-mpegurl; charset=utf-8" ||
+			w.Header().Get("Content-Disposition") != `attachment; filename="our-songs.m3u"` {
+			t.Fatalf("%q: %d %v", query, w.Code, w.Header())
+		}
+		want := "#EXTM3U\n#PLAYLIST:our songs\n" +
+			"#EXTINF:185,The Beatles - Here Comes The Sun\nhttps://open.spotify.com/track/6dGnYIeXmHdcikdzNNDMm2\n" +
+			"#EXTINF:-1,Abbey Road\nhttps://open.spotify.com/album/0ETFjACtuP2ADo6LFhL6HN\n" +
+			// a newline in a title can't start a line players would read as a path
+			"#EXTINF:-1,Line one line two\nhttps://example.com/song\n"
+		if w.Body.String() != want {
+			t.Errorf("%q: body =\n%s\nwant\n%s", query, w.Body.String(), want)
+		}
+	}
+}
+
+func TestSongExportXSPF(t *testing.T) {
+	w := exportRequest(t, "?format=xspf")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/xspf+xml; charset=utf-8" ||
+		w.Header().Get("Content-Disposition") != `attachment; filename="our-songs.xspf"` {
+		t.Fatalf("%d %v", w.Code, w.Header())
+	}
+	if !strings.HasPrefix(w.Body.String(), xml.Header) {
+		t.Errorf("missing XML header:\n%s", w.Body.String())
+	}
+	var playlist xspfPlaylist
+	if err := xml.Unmarshal(w.Body.Bytes(), &playlist); err != nil {
+		t.Fatalf("invalid XSPF: %v", err)
+	}
+	if playlist.Title != "our songs" || playlist.Version != "1" || len(playlist.Tracks) != 3 {
+		t.Fatalf("playlist = %+v", playlist)
+	}
+	want := xspfTrack{
+		Location: "https://open.spotify.com/track/6dGnYIeXmHdcikdzNNDMm2", Identifier: "isrc:GBAYE0601690",
+		Title: "Here Comes The Sun", Creator: "The Beatles", Album: "Abbey Road", Duration: 185733, Image: "https://i.scdn.co/image/abbey",
+	}
+	if playlist.Tracks[0] != want {
+		t.Errorf("track = %+v\nwant %+v", playlist.Tracks[0], want)
+	}
+	if !strings.Contains(w.Body.String(), `xmlns="http://xspf.org/ns/0/"`) {
+		t.Errorf("missing the XSPF namespace:\n%s", w.Body.String())
+	}
+}
+
+func TestSongExportJSON(t *testing.T) {
+	w := exportRequest(t, "?format=json")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") ||
+		w.Header().Get("Content-Disposition") != `attachment; filename="our-songs.json"` {
+		t.Fatalf("%d %v", w.Code, w.Header())
+	}
+	var body struct {
+		Name   string            `json:"name"`
+		Tracks []songExportTrack `json:"tracks"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	// the album isn't a track, so it's left out
+	if body.Name != "our songs" || len(body.Tracks) != 2 {
+		t.Fatalf("export = %+v", body)
+	}
+	got := body.Tracks[0]
+	if got.Title != "Here Comes The Sun" || got.ISRC != "GBAYE0601690" || got.Album != "Abbey Road" || got.DurationMs != 185733 ||
+		len(got.Artists) != 1 || got.Count != 3 || got.Links["deezer"] == "" {
+		t.Errorf("track = %+v", got)
+	}
+}
+
+func TestSongExportUnknownFormat(t *testing.T) {
+	w := exportRequest(t, "?format=csv")
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("%d %v", w.Code, w.Header())
+	}
+}
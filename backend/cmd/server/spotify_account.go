@@ -0,0 +1,226 @@
+package main
+
+import (
+	"errors"
+	"good_morning_backend/internal/database"
+	"good_morning_backend/internal/models"
+	"good_morning_backend/internal/secrets"
+	"good_morning_backend/internal/spotify"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	GoodMorningPlaylistName        = "good morning"
+	GoodMorningPlaylistDescription = "every song sent to me on good morning"
+)
+
+func spotifyRedirectURL() string {
+	return os.Getenv("SPOTIFY_REDIRECT_URL")
+}
+
+func handleSpotifyConnect(c *gin.Context) {
+	state := generateState()
+	setRedirectCookie(c, "spotify_state", state, 600, "/spotify") // 10 minutes
+	c.Redirect(http.StatusTemporaryRedirect, spotify.DefaultClient().AuthorizeURL(state, spotifyRedirectURL()))
+}
+
+func handleSpotifyCallback(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	state, err := c.Cookie("spotify_state")
+	setRedirectCookie(c, "spotify_state", "", -1, "/spotify")
+	if err != nil || state == "" || c.Query("state") != state {
+		redirectToFrontend(c, "/me?spotify=invalid_state")
+		return
+	}
+
+	if c.Query("error") != "" {
+		redirectToFrontend(c, "/me?spotify=denied")
+		return
+	}
+
+	client := spotify.DefaultClient()
+	token, err := client.ExchangeCode(c.Query("code"), spotifyRedirectURL())
+	if err != nil || token.RefreshToken == "" {
+		log.Printf("failed to exchange Spotify code: %v", err)
+		redirectToFrontend(c, "/me?spotify=error")
+		return
+	}
+
+	spotifyUser, err := client.CurrentUser(token.AccessToken)
+	if err != nil {
+		log.Printf("failed to get Spotify user: %v", err)
+		redirectToFrontend(c, "/me?spotify=error")
+		return
+	}
+
+	sealed, err := secrets.Seal(token.RefreshToken)
+	if err != nil {
+		log.Printf("failed to seal Spotify refresh token: %v", err)
+		redirectToFrontend(c, "/me?spotify=error")
+		return
+	}
+
+	var account models.SpotifyAccount
+	if err := database.DB.Where("user_id = ?", userID).First(&account).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		redirectToFrontend(c, "/me?spotify=error")
+		return
+	}
+
+	// relinking a different spotify account shouldn't keep writing to the old account's playlist
+	if account.SpotifyUserID != spotifyUser.ID {
+		account.PlaylistID = nil
+		account.PlaylistURL = nil
+	}
+	account.UserID = userID.(string)
+	account.SpotifyUserID = spotifyUser.ID
+	account.DisplayName = spotifyUser.DisplayName
+	account.RefreshToken = sealed
+
+	if account.PlaylistID == nil {
+		if err := createGoodMorningPlaylist(client, token.AccessToken, &account); err != nil {
+			log.Printf("failed to create Spotify playlist: %v", err)
+			redirectToFrontend(c, "/me?spotify=error")
+			return
+		}
+	}
+
+	if err := database.DB.Save(&account).Error; err != nil {
+		redirectToFrontend(c, "/me?spotify=error")
+		return
+	}
+
+	redirectToFrontend(c, "/me?spotify=linked")
+}
+
+func handleGetSpotifyAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var account models.SpotifyAccount
+	if err := database.DB.Where("user_id = ?", userID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusOK, gin.H{"account": nil})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get spotify account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account": account})
+}
+
+func handleDeleteSpotifyAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := database.DB.Where("user_id = ?", userID).Delete(&models.SpotifyAccount{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlink spotify account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "spotify account unlinked successfully"})
+}
+
+func createGoodMorningPlaylist(client *spotify.Client, accessToken string, account *models.SpotifyAccount) error {
+	playlist, err := client.CreatePlaylist(accessToken, account.SpotifyUserID, GoodMorningPlaylistName, GoodMorningPlaylistDescription)
+	if err != nil {
+		return err
+	}
+	account.PlaylistID = &playlist.ID
+	account.PlaylistURL = optionalString(playlist.ExternalURLs.Spotify)
+	return nil
+}
+
+// spotifyURIForNotice finds something playlist-able for the notice's song, using the cross-service link if it was shared from elsewhere
+func spotifyURIForNotice(notice *models.Notice) (string, bool) {
+	if notice.SongProvider != nil && *notice.SongProvider == "spotify" && notice.SongID != nil && notice.SongKind != nil {
+		kind := spotify.Kind(*notice.SongKind)
+		if kind == spotify.KindTrack || kind == spotify.KindEpisode {
+			return spotify.URI(kind, *notice.SongID), true
+		}
+		return "", false
+	}
+	if link, ok := notice.SongLinks["spotify"]; ok {
+		if id, err := spotify.ParseTrackID(link); err == nil {
+			return spotify.URI(spotify.KindTrack, id), true
+		}
+	}
+	return "", false
+}
+
+// addToGoodMorningPlaylist appends the notice's song to the recipient's playlist, if they've linked Spotify.
+// It runs as a retried job, so it's safe to repeat: a song that's already in the playlist isn't added again
+func addToGoodMorningPlaylist(notice *models.Notice) error {
+	uri, ok := spotifyURIForNotice(notice)
+	if !ok {
+		return nil
+	}
+
+	var account models.SpotifyAccount
+	if err := database.DB.Where("user_id = ?", notice.RecipientID).First(&account).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	err := addToAccountPlaylist(spotify.DefaultClient(), &account, uri)
+	if saveErr := database.DB.Save(&account).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// addToAccountPlaylist does the Spotify side of addToGoodMorningPlaylist, updating the account with a rotated
+// refresh token or a replacement playlist for the caller to save. The playlist is checked first because an
+// earlier attempt may have added the song and then failed, or lost the response
+func addToAccountPlaylist(client *spotify.Client, account *models.SpotifyAccount, uri string) error {
+	refreshToken, err := secrets.Open(account.RefreshToken)
+	if err != nil {
+		return err
+	}
+
+	token, err := client.RefreshUserToken(refreshToken)
+	if err != nil {
+		return err
+	}
+	if token.RefreshToken != "" && token.RefreshToken != refreshToken {
+		if account.RefreshToken, err = secrets.Seal(token.RefreshToken); err != nil {
+			return err
+		}
+	}
+
+	if account.PlaylistID != nil {
+		var found bool
+		found, err = client.PlaylistContains(token.AccessToken, *account.PlaylistID, uri)
+		if err == nil && found {
+			return nil
+		}
+		if err == nil {
+			err = client.AddToPlaylist(token.AccessToken, *account.PlaylistID, uri)
+		}
+	}
+	// the user may have deleted the playlist, start a fresh one
+	if account.PlaylistID == nil || errors.Is(err, spotify.ErrPlaylistNotFound) {
+		if err = createGoodMorningPlaylist(client, token.AccessToken, account); err == nil {
+			err = client.AddToPlaylist(token.AccessToken, *account.PlaylistID, uri)
+		}
+	}
+	return err
+}
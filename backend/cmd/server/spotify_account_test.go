@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"good_morning_backend/internal/models"
+	"good_morning_backend/internal/secrets"
+	"good_morning_backend/internal/spotify"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// the key is loaded once per process, so every test that seals tokens uses this one
+func setTestEncryptionKey(t *testing.T) {
+	os.Setenv("TOKEN_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if _, err := secrets.Seal("probe"); err != nil {
+		t.Fatalf("encryption key: %v", err)
+	}
+}
+
+// playlistStub is a Spotify API whose adds can be made to fail after they've been applied,
+// like a response lost on the way back
+type playlistStub struct {
+	mu            sync.Mutex
+	playlists     map[string][]string
+	loseNextReply bool
+}
+
+func newPlaylistStub(t *testing.T) (*playlistStub, *spotify.Client) {
+	stub := &playlistStub{playlists: map[string][]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(spotify.SpotifyTokenResponse{AccessToken: "access", RefreshToken: "rotated", ExpiresIn: 3600})
+	})
+	mux.HandleFunc("POST /v1/users/{user}/playlists", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		id := fmt.Sprintf("playlist%d", len(stub.playlists)+1)
+		stub.playlists[id] = nil
+		fmt.Fprintf(w, `{"id": %q, "external_urls": {"spotify": "https://open.spotify.com/playlist/%s"}}`, id, id)
+	})
+	mux.HandleFunc("GET /v1/playlists/{id}", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		if _, ok := stub.playlists[r.PathValue("id")]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"id": %q}`, r.PathValue("id"))
+	})
+	mux.HandleFunc("/v1/playlists/{id}/tracks", func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+		id := r.PathValue("id")
+		items, ok := stub.playlists[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			var page []map[string]interface{}
+			for _, uri := range items {
+				page = append(page, map[string]interface{}{"track": map[string]string{"uri": uri}})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": page, "total": len(items)})
+			return
+		}
+		var body struct {
+			URIs []string `json:"uris"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, uri := range body.URIs {
+			if uri == unavailableTrackURI {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		stub.playlists[id] = append(items, body.URIs...)
+		if stub.loseNextReply {
+			stub.loseNextReply = false
+			http.Error(w, "gateway timeout", http.StatusGatewayTimeout)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := spotify.NewClient("id", "secret")
+	client.AccountsURL = server.URL
+	client.APIURL = server.URL + "/v1"
+	return stub, client
+}
+
+func (s *playlistStub) items(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.playlists[id]...)
+}
+
+func testSpotifyAccount(t *testing.T) *models.SpotifyAccount {
+	sealed, err := secrets.Seal("refresh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.SpotifyAccount{UserID: "user_1", SpotifyUserID: "listener", RefreshToken: sealed}
+}
+
+const (
+	testTrackURI = "spotify:track:4uLU6hMCjMI75M1A2tKUQC"
+	// adding this track 404s even though the playlist is there
+	unavailableTrackURI = "spotify:track:unavailable"
+)
+
+func TestAddToAccountPlaylistRetryDoesNotDuplicate(t *testing.T) {
+	setTestEncryptionKey(t)
+	stub, client := newPlaylistStub(t)
+	account := testSpotifyAccount(t)
+
+	stub.loseNextReply = true
+	if err := addToAccountPlaylist(client, account, testTrackURI); err == nil {
+		t.Fatal("first attempt should report the lost reply")
+	}
+	if account.PlaylistID == nil {
+		t.Fatal("playlist wasn't created")
+	}
+
+	// the job queue retries; the song is already there
+	if err := addToAccountPlaylist(client, account, testTrackURI); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if got := stub.items(*account.PlaylistID); len(got) != 1 || got[0] != testTrackURI {
+		t.Errorf("playlist = %v, want the song once", got)
+	}
+
+	// the rotated refresh token is sealed for the caller to save
+	if refresh, err := secrets.Open(account.RefreshToken); err != nil || refresh != "rotated" {
+		t.Errorf("refresh token = %q, %v; want rotated", refresh, err)
+	}
+}
+
+func TestAddToAccountPlaylistRecreatesDeletedPlaylist(t *testing.T) {
+	setTestEncryptionKey(t)
+	stub, client := newPlaylistStub(t)
+	account := testSpotifyAccount(t)
+	deleted := "deleted"
+	account.PlaylistID = &deleted
+
+	if err := addToAccountPlaylist(client, account, testTrackURI); err != nil {
+		t.Fatalf("addToAccountPlaylist: %v", err)
+	}
+	if *account.PlaylistID == deleted {
+		t.Fatal("deleted playlist wasn't replaced")
+	}
+	if account.PlaylistURL == nil || *account.PlaylistURL != "https://open.spotify.com/playlist/"+*account.PlaylistID {
+		t.Errorf("playlist url = %v", account.PlaylistURL)
+	}
+	if got := stub.items(*account.PlaylistID); len(got) != 1 || got[0] != testTrackURI {
+		t.Errorf("playlist = %v, want the song once", got)
+	}
+}
+
+func TestAddToAccountPlaylistKeepsPlaylistOnOtherNotFound(t *testing.T) {
+	setTestEncryptionKey(t)
+	stub, client := newPlaylistStub(t)
+	account := testSpotifyAccount(t)
+	if err := addToAccountPlaylist(client, account, testTrackURI); err != nil {
+		t.Fatalf("addToAccountPlaylist: %v", err)
+	}
+	playlistID := *account.PlaylistID
+
+	if err := addToAccountPlaylist(client, account, unavailableTrackURI); !errors.Is(err, spotify.ErrNotFound) {
+		t.Fatalf("adding an unavailable track = %v, want ErrNotFound", err)
+	}
+	if *account.PlaylistID != playlistID {
+		t.Errorf("playlist replaced with %s after a track 404", *account.PlaylistID)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.playlists) != 1 {
+		t.Errorf("created %d playlists, want 1", len(stub.playlists))
+	}
+}
+
+func TestSpotifyURIForNotice(t *testing.T) {
+	str := func(s string) *string { return &s }
+	tests := []struct {
+		name   string
+		notice models.Notice
+		want   string
+		wantOK bool
+	}{
+		{"spotify track", models.Notice{SongProvider: str("spotify"), SongKind: str("track"), SongID: str("4uLU6hMCjMI75M1A2tKUQC")}, testTrackURI, true},
+		{"spotify episode", models.Notice{SongProvider: str("spotify"), SongKind: str("episode"), SongID: str("4uLU6hMCjMI75M1A2tKUQC")}, "spotify:episode:4uLU6hMCjMI75M1A2tKUQC", true},
+		{"spotify album", models.Notice{SongProvider: str("spotify"), SongKind: str("album"), SongID: str("4uLU6hMCjMI75M1A2tKUQC")}, "", false},
+		{"deezer with spotify link", models.Notice{SongProvider: str("deezer"), SongLinks: map[string]string{"spotify": "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC"}}, testTrackURI, true},
+		{"deezer only", models.Notice{SongProvider: str("deezer"), SongLinks: map[string]string{"deezer": "https://www.deezer.com/track/1"}}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := spotifyURIForNotice(&tt.notice)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("spotifyURIForNotice = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
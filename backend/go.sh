@@ -3,6 +3,6 @@
 set -e
 
 go mod tidy
-go build -o server cmd/server/main.go
+go build -o server ./cmd/server
 
 ./server
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"good_morning_backend/internal/google"
+)
+
+var (
+	ErrNotConfigured    = errors.New("login provider is not configured")
+	ErrEmailNotVerified = errors.New("email address is not verified")
+)
+
+// Profile is who a provider says is signing in; Subject is the provider's stable ID for them,
+// which unlike the email never changes
+type Profile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// Provider is a redirect login using the authorization code flow with PKCE
+type Provider interface {
+	Name() string
+	Configured() bool
+	AuthCodeURL(state, codeChallenge string) string
+	Exchange(code, codeVerifier string) (*Profile, error)
+}
+
+type Registry struct {
+	mu        sync.RWMutex
+	providers []Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers = append(r.providers, p)
+}
+
+func (r *Registry) Providers() []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Provider(nil), r.providers...)
+}
+
+// Get returns a provider by name, skipping ones without credentials
+func (r *Registry) Get(name string) (Provider, bool) {
+	for _, p := range r.Providers() {
+		if p.Name() == name && p.Configured() {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+var (
+	defaultRegistry     *Registry
+	defaultRegistryOnce sync.Once
+)
+
+// DefaultRegistry holds every login provider we support, configured from the environment
+func DefaultRegistry() *Registry {
+	defaultRegistryOnce.Do(func() {
+		defaultRegistry = NewRegistry(
+			NewOIDC("google", google.DefaultClient()),
+			GitHubFromEnv(),
+		)
+		if oidc := OIDCFromEnv(); oidc != nil {
+			defaultRegistry.Register(oidc)
+		}
+	})
+	return defaultRegistry
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// Mailer sends login links over SMTP. Any server works, including a local sink like MailHog
+type Mailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+// MailerFromEnv reads SMTP_ADDR (host:port), SMTP_FROM, SMTP_USERNAME and SMTP_PASSWORD
+func MailerFromEnv() *Mailer {
+	return &Mailer{
+		Addr:     os.Getenv("SMTP_ADDR"),
+		From:     os.Getenv("SMTP_FROM"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+func (m *Mailer) Configured() bool {
+	return m.Addr != "" && m.From != ""
+}
+
+// NormalizeEmail validates a bare address and lowercases it, so one inbox is one identity
+func NormalizeEmail(address string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil || parsed.Name != "" || strings.ContainsAny(parsed.Address, "\r\n") {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(parsed.Address), nil
+}
+
+// SendMagicLink emails a single-use sign-in link
+func (m *Mailer) SendMagicLink(to, link string, ttl time.Duration) error {
+	if !m.Configured() {
+		return ErrNotConfigured
+	}
+	to, err := NormalizeEmail(to)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Someone (hopefully you) asked to sign in to good morning!\r\n\r\n"+
+		"Open this link to sign in:\r\n%s\r\n\r\n"+
+		"It works once and expires in %d minutes. If you didn't ask for it, you can ignore this email.\r\n",
+		link, int(ttl.Minutes()))
+
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: Your good morning! sign-in link",
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var smtpAuth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		smtpAuth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	return smtp.SendMail(m.Addr, smtpAuth, from.Address, []string{to}, []byte(msg))
+}
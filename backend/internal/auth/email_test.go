@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpSink is just enough of an SMTP server to accept messages and keep them; DotReader hands back LF line endings
+type smtpSink struct {
+	net.Listener
+	mu       sync.Mutex
+	auth     string
+	from     string
+	rcpt     []string
+	messages []string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{Listener: l}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 sink ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-sink")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			_, creds, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(creds)
+			s.mu.Lock()
+			s.auth = string(decoded)
+			s.mu.Unlock()
+			tp.PrintfLine("235 ok")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = arg
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.rcpt = append(s.rcpt, arg)
+			s.mu.Unlock()
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, err := io.ReadAll(tp.DotReader())
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func TestSendMagicLink(t *testing.T) {
+	sink := newSMTPSink(t)
+	mailer := &Mailer{Addr: sink.Addr().String(), From: "good morning <hello@example.com>"}
+
+	link := "https://api.example.com/auth/email/verify?token=abc_DEF-123"
+	if err := mailer.SendMagicLink("Someone@Example.com", link, 15*time.Minute); err != nil {
+		t.Fatalf("SendMagicLink: %v", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.from != "FROM:<hello@example.com>" {
+		t.Errorf("MAIL %s", sink.from)
+	}
+	if len(sink.rcpt) != 1 || sink.rcpt[0] != "TO:<someone@example.com>" {
+		t.Errorf("RCPT %v", sink.rcpt)
+	}
+	if sink.auth != "" {
+		t.Errorf("authenticated without credentials: %q", sink.auth)
+	}
+	if len(sink.messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(sink.messages))
+	}
+
+	msg, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(sink.messages[0])))
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	headers := map[string]string{
+		"From":         "good morning <hello@example.com>",
+		"To":           "someone@example.com",
+		"Subject":      "Your good morning! sign-in link",
+		"Mime-Version": "1.0",
+		"Content-Type": "text/plain; charset=UTF-8",
+	}
+	for name, want := range headers {
+		if got := msg.Header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if !strings.Contains(string(body), "\n"+link+"\n") {
+		t.Errorf("body doesn't contain the link on its own line:\n%s", body)
+	}
+	if !strings.Contains(string(body), "15 minutes") {
+		t.Errorf("body doesn't mention the expiry:\n%s", body)
+	}
+}
+
+func TestSendMagicLinkAuth(t *testing.T) {
+	sink := newSMTPSink(t)
+	mailer := &Mailer{Addr: sink.Addr().String(), From: "hello@example.com", Username: "user", Password: "pass"}
+
+	if err := mailer.SendMagicLink("someone@example.com", "https://example.com/link", time.Minute); err != nil {
+		t.Fatalf("SendMagicLink: %v", err)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.auth != "\x00user\x00pass" {
+		t.Errorf("AUTH PLAIN = %q", sink.auth)
+	}
+}
+
+func TestSendMagicLinkRejects(t *testing.T) {
+	sink := newSMTPSink(t)
+	mailer := &Mailer{Addr: sink.Addr().String(), From: "hello@example.com"}
+
+	for _, to := range []string{"someone@example.com\r\nBcc: everyone@example.com", "Someone <someone@example.com>", "not an address"} {
+		if err := mailer.SendMagicLink(to, "https://example.com/link", time.Minute); err != ErrInvalidEmail {
+			t.Errorf("SendMagicLink(%q) = %v, want ErrInvalidEmail", to, err)
+		}
+	}
+	if err := (&Mailer{}).SendMagicLink("someone@example.com", "https://example.com/link", time.Minute); err != ErrNotConfigured {
+		t.Errorf("unconfigured SendMagicLink = %v, want ErrNotConfigured", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.messages) != 0 {
+		t.Errorf("sent %d messages to invalid recipients", len(sink.messages))
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"someone@example.com", "someone@example.com", false},
+		{"  Someone@Example.COM\n", "someone@example.com", false},
+		{"Someone <someone@example.com>", "", true},
+		{"someone", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.in)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("NormalizeEmail(%q) = %q, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultGitHubAuthURL  = "https://github.com/login/oauth/authorize"
+	DefaultGitHubTokenURL = "https://github.com/login/oauth/access_token"
+	DefaultGitHubAPIURL   = "https://api.github.com"
+)
+
+// GitHub is plain OAuth 2, without ID tokens, so the profile comes from the REST API
+type GitHub struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	APIURL       string
+	HTTPClient   *http.Client
+}
+
+func NewGitHub(clientID, clientSecret, redirectURL string) *GitHub {
+	return &GitHub{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      DefaultGitHubAuthURL,
+		TokenURL:     DefaultGitHubTokenURL,
+		APIURL:       DefaultGitHubAPIURL,
+		HTTPClient:   defaultHTTPClient,
+	}
+}
+
+// GitHubFromEnv reads GITHUB_CLIENT_ID, GITHUB_CLIENT_SECRET and GITHUB_REDIRECT_URL, with
+// endpoint overrides for testing against a fake
+func GitHubFromEnv() *GitHub {
+	p := NewGitHub(os.Getenv("GITHUB_CLIENT_ID"), os.Getenv("GITHUB_CLIENT_SECRET"), os.Getenv("GITHUB_REDIRECT_URL"))
+	if v := os.Getenv("GITHUB_AUTH_URL"); v != "" {
+		p.AuthURL = v
+	}
+	if v := os.Getenv("GITHUB_TOKEN_URL"); v != "" {
+		p.TokenURL = v
+	}
+	if v := os.Getenv("GITHUB_API_URL"); v != "" {
+		p.APIURL = strings.TrimSuffix(v, "/")
+	}
+	return p
+}
+
+func (p *GitHub) Name() string {
+	return "github"
+}
+
+func (p *GitHub) Configured() bool {
+	return p.ClientID != "" && p.ClientSecret != ""
+}
+
+func (p *GitHub) AuthCodeURL(state, codeChallenge string) string {
+	params := url.Values{}
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", "read:user user:email")
+	params.Set("state", state)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+	params.Set("allow_signup", "false")
+	return p.AuthURL + "?" + params.Encode()
+}
+
+type githubUser struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (p *GitHub) Exchange(code, codeVerifier string) (*Profile, error) {
+	if !p.Configured() {
+		return nil, ErrNotConfigured
+	}
+
+	data := url.Values{}
+	data.Set("client_id", p.ClientID)
+	data.Set("client_secret", p.ClientSecret)
+	data.Set("code", code)
+	data.Set("redirect_uri", p.RedirectURL)
+	data.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", p.TokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.do(req, &token); err != nil {
+		return nil, fmt.Errorf("GitHub token error: %w", err)
+	}
+	// GitHub reports a bad code with a 200 and an error field
+	if token.Error != "" {
+		return nil, fmt.Errorf("GitHub token error: %s: %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("GitHub token response missing access_token")
+	}
+
+	var user githubUser
+	if err := p.get(token.AccessToken, "/user", &user); err != nil {
+		return nil, fmt.Errorf("GitHub user: %w", err)
+	}
+	var emails []githubEmail
+	if err := p.get(token.AccessToken, "/user/emails", &emails); err != nil {
+		return nil, fmt.Errorf("GitHub emails: %w", err)
+	}
+
+	// the public profile email can be unverified, so only trust the primary verified address
+	var email string
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			email = e.Email
+			break
+		}
+	}
+	if email == "" {
+		return nil, fmt.Errorf("github: %w", ErrEmailNotVerified)
+	}
+
+	name := user.Name
+	if name == "" {
+		name = user.Login
+	}
+	return &Profile{
+		Provider:      p.Name(),
+		Subject:       strconv.FormatInt(user.ID, 10),
+		Email:         email,
+		EmailVerified: true,
+		Name:          name,
+		Picture:       user.AvatarURL,
+	}, nil
+}
+
+func (p *GitHub) get(accessToken, path string, out interface{}) error {
+	req, err := http.NewRequest("GET", p.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	return p.do(req, out)
+}
+
+func (p *GitHub) do(req *http.Request, out interface{}) error {
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// newFakeGitHub serves the token, /user and /user/emails endpoints; emails is what /user/emails returns
+func newFakeGitHub(t *testing.T, emails []githubEmail) *GitHub {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json" {
+			http.Error(w, "want json", http.StatusNotAcceptable)
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("client_id") != "id" || r.PostForm.Get("client_secret") != "secret" {
+			http.Error(w, "bad client", http.StatusUnauthorized)
+			return
+		}
+		// like GitHub, a bad code is still a 200
+		if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("code_verifier") != "verifier" {
+			w.Write([]byte(`{"error": "bad_verification_code", "error_description": "The code passed is incorrect or expired."}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "gho_token", "token_type": "bearer", "scope": "read:user,user:email"}`))
+	})
+	authed := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer gho_token" {
+				http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /user", authed(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": 583231, "login": "octocat", "name": "", "avatar_url": "https://avatars.example/u/583231", "email": "public@example.com"}`))
+	}))
+	mux.HandleFunc("GET /user/emails", authed(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(emails)
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	p := NewGitHub("id", "secret", "https://app.example/auth/github/callback")
+	p.TokenURL = server.URL + "/login/oauth/access_token"
+	p.APIURL = server.URL
+	p.HTTPClient = server.Client()
+	return p
+}
+
+func TestGitHubExchange(t *testing.T) {
+	p := newFakeGitHub(t, []githubEmail{
+		{Email: "public@example.com", Primary: false, Verified: false},
+		{Email: "octocat@example.com", Primary: true, Verified: true},
+	})
+
+	profile, err := p.Exchange("good-code", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	want := Profile{
+		Provider:      "github",
+		Subject:       "583231",
+		Email:         "octocat@example.com",
+		EmailVerified: true,
+		Name:          "octocat",
+		Picture:       "https://avatars.example/u/583231",
+	}
+	if *profile != want {
+		t.Errorf("Exchange = %+v\nwant %+v", *profile, want)
+	}
+
+	if _, err := p.Exchange("used-code", "verifier"); err == nil || !strings.Contains(err.Error(), "bad_verification_code") {
+		t.Errorf("Exchange with a bad code = %v", err)
+	}
+	if _, err := p.Exchange("good-code", "wrong-verifier"); err == nil {
+		t.Error("Exchange accepted the wrong PKCE verifier")
+	}
+}
+
+func TestGitHubExchangeUnverifiedEmail(t *testing.T) {
+	tests := map[string][]githubEmail{
+		"primary unverified":       {{Email: "octocat@example.com", Primary: true, Verified: false}},
+		"verified but not primary": {{Email: "octocat@example.com", Primary: false, Verified: true}},
+		"no emails":                nil,
+	}
+	for name, emails := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newFakeGitHub(t, emails)
+			if _, err := p.Exchange("good-code", "verifier"); !errors.Is(err, ErrEmailNotVerified) {
+				t.Errorf("Exchange = %v, want ErrEmailNotVerified", err)
+			}
+		})
+	}
+}
+
+func TestGitHubAuthCodeURL(t *testing.T) {
+	p := NewGitHub("id", "secret", "https://app.example/auth/github/callback")
+	u, err := url.Parse(p.AuthCodeURL("state123", "challenge"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Host != "github.com" || q.Get("client_id") != "id" || q.Get("state") != "state123" ||
+		q.Get("code_challenge") != "challenge" || q.Get("code_challenge_method") != "S256" ||
+		q.Get("redirect_uri") != "https://app.example/auth/github/callback" || q.Get("scope") != "read:user user:email" {
+		t.Errorf("AuthCodeURL = %s", u)
+	}
+
+	if _, err := NewGitHub("", "", "").Exchange("good-code", "verifier"); err != ErrNotConfigured {
+		t.Errorf("unconfigured Exchange = %v, want ErrNotConfigured", err)
+	}
+}
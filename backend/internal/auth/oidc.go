@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"good_morning_backend/internal/google"
+)
+
+// OIDC logs in with any OpenID Connect provider; the google client speaks plain OIDC once its endpoints are set
+type OIDC struct {
+	name   string
+	client *google.Client
+}
+
+func NewOIDC(name string, client *google.Client) *OIDC {
+	return &OIDC{name: name, client: client}
+}
+
+// OIDCFromEnv configures an extra provider (Apple, a company IdP, a local fake) from OIDC_*, or returns nil.
+// OIDC_ISSUER and OIDC_JWKS_URL are required, since without them ID tokens can't be checked
+func OIDCFromEnv() *OIDC {
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	if clientID == "" {
+		return nil
+	}
+	client := google.NewClient(clientID, os.Getenv("OIDC_CLIENT_SECRET"), os.Getenv("OIDC_REDIRECT_URL"))
+	client.AuthURL = os.Getenv("OIDC_AUTH_URL")
+	client.TokenURL = os.Getenv("OIDC_TOKEN_URL")
+	client.JWKSURL = os.Getenv("OIDC_JWKS_URL")
+	client.Issuers = []string{os.Getenv("OIDC_ISSUER")}
+
+	name := os.Getenv("OIDC_NAME")
+	if name == "" {
+		name = "oidc"
+	}
+	if client.JWKSURL == "" || client.Issuers[0] == "" {
+		log.Printf("OIDC_CLIENT_ID is set but OIDC_ISSUER or OIDC_JWKS_URL isn't, so %s login is disabled", name)
+		return nil
+	}
+	return NewOIDC(name, client)
+}
+
+func (p *OIDC) Name() string {
+	return p.name
+}
+
+func (p *OIDC) Configured() bool {
+	c := p.client
+	if c.ClientID == "" || c.ClientSecret == "" || c.AuthURL == "" || c.TokenURL == "" || c.JWKSURL == "" || len(c.Issuers) == 0 {
+		return false
+	}
+	for _, issuer := range c.Issuers {
+		if issuer == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *OIDC) AuthCodeURL(state, codeChallenge string) string {
+	return p.client.AuthCodeURL(state, codeChallenge)
+}
+
+func (p *OIDC) Exchange(code, codeVerifier string) (*Profile, error) {
+	token, err := p.client.Exchange(code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := p.client.VerifyIDToken(token.IDToken)
+	if errors.Is(err, google.ErrEmailNotVerified) {
+		return nil, fmt.Errorf("%s: %w", p.name, ErrEmailNotVerified)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Profile{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+	}, nil
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"good_morning_backend/internal/google"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testOIDCIssuer = "https://idp.example"
+
+// newFakeIdP is an OIDC provider whose token endpoint returns whatever ID token claims says, signed with its key
+func newFakeIdP(t *testing.T, claims *google.IDTokenClaims) *httptest.Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		raw, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(google.TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 3600, IDToken: raw})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setOIDCEnv(t *testing.T, server *httptest.Server) {
+	t.Setenv("OIDC_NAME", "idp")
+	t.Setenv("OIDC_CLIENT_ID", "client-id")
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_REDIRECT_URL", "https://app.example/auth/idp/callback")
+	t.Setenv("OIDC_AUTH_URL", server.URL+"/authorize")
+	t.Setenv("OIDC_TOKEN_URL", server.URL+"/token")
+	t.Setenv("OIDC_JWKS_URL", server.URL+"/jwks")
+	t.Setenv("OIDC_ISSUER", testOIDCIssuer)
+}
+
+func TestOIDCFromEnvRequiresIssuerAndJWKS(t *testing.T) {
+	server := newFakeIdP(t, &google.IDTokenClaims{})
+	setOIDCEnv(t, server)
+	if p := OIDCFromEnv(); p == nil || !p.Configured() || p.Name() != "idp" {
+		t.Fatalf("OIDCFromEnv with everything set = %+v", p)
+	}
+
+	for _, unset := range []string{"OIDC_ISSUER", "OIDC_JWKS_URL"} {
+		t.Run(unset, func(t *testing.T) {
+			setOIDCEnv(t, server)
+			t.Setenv(unset, "")
+			if p := OIDCFromEnv(); p != nil {
+				t.Errorf("OIDCFromEnv without %s = %+v, want nil", unset, p)
+			}
+		})
+	}
+
+	t.Setenv("OIDC_CLIENT_ID", "")
+	if p := OIDCFromEnv(); p != nil {
+		t.Errorf("OIDCFromEnv without a client = %+v, want nil", p)
+	}
+}
+
+func TestOIDCConfigured(t *testing.T) {
+	newClient := func() *google.Client {
+		client := google.NewClient("client-id", "secret", "https://app.example/callback")
+		client.Issuers = []string{testOIDCIssuer}
+		return client
+	}
+	if !NewOIDC("idp", newClient()).Configured() {
+		t.Fatal("fully configured provider isn't Configured")
+	}
+	for name, mutate := range map[string]func(*google.Client){
+		"no jwks":      func(c *google.Client) { c.JWKSURL = "" },
+		"no issuers":   func(c *google.Client) { c.Issuers = nil },
+		"empty issuer": func(c *google.Client) { c.Issuers = []string{""} },
+		"no secret":    func(c *google.Client) { c.ClientSecret = "" },
+	} {
+		c := newClient()
+		mutate(c)
+		if NewOIDC("idp", c).Configured() {
+			t.Errorf("%s: Configured = true", name)
+		}
+	}
+}
+
+func TestOIDCExchangeChecksIssuer(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		issuer  string
+		wantErr bool
+	}{
+		{"matching iss", testOIDCIssuer, false},
+		{"empty iss", "", true},
+		{"another provider's iss", "https://accounts.google.com", true},
+		{"lookalike iss", testOIDCIssuer + ".evil.example", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &google.IDTokenClaims{
+				Email:         "someone@example.com",
+				EmailVerified: true,
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject:   "user-1",
+					Issuer:    tt.issuer,
+					Audience:  jwt.ClaimStrings{"client-id"},
+					IssuedAt:  jwt.NewNumericDate(now),
+					ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+				},
+			}
+			setOIDCEnv(t, newFakeIdP(t, claims))
+			p := OIDCFromEnv()
+			if p == nil {
+				t.Fatal("OIDCFromEnv = nil")
+			}
+
+			profile, err := p.Exchange("code", "verifier")
+			if tt.wantErr {
+				if !errors.Is(err, google.ErrInvalidIDToken) {
+					t.Errorf("Exchange = %+v, %v; want ErrInvalidIDToken", profile, err)
+				}
+				return
+			}
+			if err != nil || profile.Provider != "idp" || profile.Subject != "user-1" {
+				t.Errorf("Exchange = %+v, %v", profile, err)
+			}
+		})
+	}
+}
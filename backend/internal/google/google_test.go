@@ -0,0 +1,200 @@
+package google
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testClientID = "client-id"
+	testIssuer   = "https://issuer.example"
+)
+
+// fakeProvider is a minimal OIDC provider: a token endpoint and a JWKS endpoint publishing whichever keys are current
+type fakeProvider struct {
+	*httptest.Server
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey
+	published  []string
+	jwksHits   atomic.Int32
+	idToken    string
+	tokenCalls atomic.Int32
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	p := &fakeProvider{keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /certs", func(w http.ResponseWriter, r *http.Request) {
+		p.jwksHits.Add(1)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		var set jwks
+		for _, kid := range p.published {
+			pub := p.keys[kid].PublicKey
+			set.Keys = append(set.Keys, struct {
+				Kty string `json:"kty"`
+				Kid string `json:"kid"`
+				Use string `json:"use"`
+				N   string `json:"n"`
+				E   string `json:"e"`
+			}{"RSA", kid, "sig", base64.RawURLEncoding.EncodeToString(pub.N.Bytes()), base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())})
+		}
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		p.tokenCalls.Add(1)
+		if r.FormValue("client_id") != testClientID || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client"}`))
+			return
+		}
+		switch r.FormValue("code") {
+		case "good-code":
+			if r.FormValue("code_verifier") != "verifier" || r.FormValue("grant_type") != "authorization_code" {
+				http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 3600, IDToken: p.idToken})
+		case "no-id-token":
+			json.NewEncoder(w).Encode(TokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 3600})
+		case "outage":
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "invalid_grant", "error_description": "Bad Request"}`))
+		}
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	p.rotate(t, "key-1")
+	return p
+}
+
+// rotate adds a new signing key and publishes only it, like a provider retiring its old key
+func (p *fakeProvider) rotate(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.mu.Lock()
+	p.keys[kid] = key
+	p.published = []string{kid}
+	p.mu.Unlock()
+}
+
+func (p *fakeProvider) sign(t *testing.T, kid string, claims IDTokenClaims) string {
+	t.Helper()
+	p.mu.Lock()
+	key := p.keys[kid]
+	p.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func (p *fakeProvider) client() (*Client, *fakeClock) {
+	clock := &fakeClock{t: time.Now()}
+	client := NewClient(testClientID, "secret", "https://app.example/auth/google/callback")
+	client.TokenURL = p.URL + "/token"
+	client.JWKSURL = p.URL + "/certs"
+	client.Issuers = []string{testIssuer}
+	client.HTTPClient = p.Server.Client()
+	client.now = clock.Now
+	return client, clock
+}
+
+func validClaims(now time.Time) IDTokenClaims {
+	return IDTokenClaims{
+		Email:         "someone@example.com",
+		EmailVerified: true,
+		Name:          "Someone",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "1234567890",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+}
+
+func TestExchange(t *testing.T) {
+	provider := newFakeProvider(t)
+	client, _ := provider.client()
+	provider.idToken = "header.payload.signature"
+
+	token, err := client.Exchange("good-code", "verifier")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if token.IDToken != provider.idToken || token.AccessToken != "access" {
+		t.Errorf("Exchange = %+v", token)
+	}
+
+	if _, err := client.Exchange("no-id-token", "verifier"); err != ErrMissingIDToken {
+		t.Errorf("Exchange without an id_token = %v, want ErrMissingIDToken", err)
+	}
+
+	tests := []struct {
+		code string
+		want TokenError
+	}{
+		{"used-code", TokenError{StatusCode: http.StatusBadRequest, Code: "invalid_grant", Description: "Bad Request"}},
+		{"outage", TokenError{StatusCode: http.StatusBadGateway}},
+	}
+	for _, tt := range tests {
+		_, err := client.Exchange(tt.code, "verifier")
+		tokenErr, ok := err.(*TokenError)
+		if !ok {
+			t.Errorf("Exchange(%s) = %v, want a *TokenError", tt.code, err)
+			continue
+		}
+		if *tokenErr != tt.want {
+			t.Errorf("Exchange(%s) = %+v, want %+v", tt.code, *tokenErr, tt.want)
+		}
+	}
+
+	unconfigured := NewClient("", "", "")
+	unconfigured.TokenURL = provider.URL + "/token"
+	calls := provider.tokenCalls.Load()
+	if _, err := unconfigured.Exchange("good-code", "verifier"); err != ErrNotConfigured {
+		t.Errorf("Exchange without credentials = %v, want ErrNotConfigured", err)
+	}
+	if provider.tokenCalls.Load() != calls {
+		t.Error("an unconfigured client called the token endpoint")
+	}
+}
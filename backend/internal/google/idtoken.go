@@ -0,0 +1,217 @@
+package google
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// how long to keep keys when the JWKS response has no max-age
+	defaultKeysTTL = time.Hour
+	// an unknown kid triggers a refetch, but no more often than this, so forged tokens can't hammer the endpoint
+	minKeysRefetch = time.Minute
+	// allowed clock drift between us and the provider
+	clockSkew = time.Minute
+)
+
+// IDTokenClaims are the OIDC claims we rely on; Subject is the stable account ID
+type IDTokenClaims struct {
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+	Picture       string   `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// flexBool accepts both true and "true"; Apple and some other providers send booleans as strings
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = flexBool(v)
+	case string:
+		parsed, _ := strconv.ParseBool(v)
+		*b = flexBool(parsed)
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// VerifyIDToken checks the signature against the provider's JWKS, then aud, iss and exp,
+// and finally that the email has been verified
+func (c *Client) VerifyIDToken(raw string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	now := c.now()
+	switch {
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	case !claims.VerifyAudience(c.ClientID, true):
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIDToken)
+	case !c.validIssuer(claims.Issuer):
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case claims.ExpiresAt == nil || now.After(claims.ExpiresAt.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	case claims.IssuedAt != nil && claims.IssuedAt.After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	return claims, nil
+}
+
+func (c *Client) validIssuer(iss string) bool {
+	if iss == "" {
+		return false
+	}
+	for _, allowed := range c.Issuers {
+		if iss == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the public key for kid, refreshing the cached JWKS when it has expired or
+// doesn't know the kid (Google rotates keys every few days)
+func (c *Client) key(kid string) (interface{}, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	fresh := c.now().Before(c.keysExpiry)
+	canRefetch := c.now().Sub(c.keysFetched) >= minKeysRefetch
+	c.mu.Unlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+	if !fresh || canRefetch {
+		if _, err, _ := c.fetchKeys.Do("jwks", func() (interface{}, error) {
+			return nil, c.refreshKeys()
+		}); err != nil {
+			// keep using a stale key rather than failing every login while the endpoint is down
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+		c.mu.Lock()
+		key, ok = c.keys[kid]
+		c.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (c *Client) refreshKeys() error {
+	resp, err := c.HTTPClient.Get(c.JWKSURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Google JWKS error: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var set jwks
+	if err := json.Unmarshal(body, &set); err != nil {
+		return fmt.Errorf("decode Google JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := rsaPublicKey(k.N, k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("Google JWKS has no usable keys")
+	}
+
+	now := c.now()
+	c.mu.Lock()
+	c.keys = keys
+	c.keysFetched = now
+	c.keysExpiry = now.Add(cacheMaxAge(resp.Header, defaultKeysTTL))
+	c.mu.Unlock()
+	return nil
+}
+
+func rsaPublicKey(n, e string) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(n)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(e)
+	if err != nil {
+		return nil, err
+	}
+	exp := new(big.Int).SetBytes(eBytes)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid RSA exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(exp.Int64())}, nil
+}
+
+// cacheMaxAge reads max-age from Cache-Control, which Google sets to match its key rotation
+func cacheMaxAge(h http.Header, fallback time.Duration) time.Duration {
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(directive), "=")
+		if !ok || !strings.EqualFold(name, "max-age") {
+			continue
+		}
+		if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,156 @@
+package google
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestVerifyIDToken(t *testing.T) {
+	provider := newFakeProvider(t)
+	client, clock := provider.client()
+	now := clock.Now()
+
+	tests := []struct {
+		name    string
+		mutate  func(*IDTokenClaims)
+		wantErr error
+	}{
+		{"valid", func(*IDTokenClaims) {}, nil},
+		{"wrong aud", func(c *IDTokenClaims) { c.Audience = jwt.ClaimStrings{"someone-else"} }, ErrInvalidIDToken},
+		{"extra aud", func(c *IDTokenClaims) { c.Audience = jwt.ClaimStrings{"someone-else", testClientID} }, nil},
+		{"wrong iss", func(c *IDTokenClaims) { c.Issuer = "https://evil.example" }, ErrInvalidIDToken},
+		{"empty iss", func(c *IDTokenClaims) { c.Issuer = "" }, ErrInvalidIDToken},
+		{"missing sub", func(c *IDTokenClaims) { c.Subject = "" }, ErrInvalidIDToken},
+		{"expired", func(c *IDTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-2 * clockSkew)) }, ErrInvalidIDToken},
+		{"expired within skew", func(c *IDTokenClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-clockSkew / 2)) }, nil},
+		{"no exp", func(c *IDTokenClaims) { c.ExpiresAt = nil }, ErrInvalidIDToken},
+		{"issued in the future", func(c *IDTokenClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(2 * clockSkew)) }, ErrInvalidIDToken},
+		{"email not verified", func(c *IDTokenClaims) { c.EmailVerified = false }, ErrEmailNotVerified},
+		{"no email", func(c *IDTokenClaims) { c.Email = "" }, ErrEmailNotVerified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims(now)
+			tt.mutate(&claims)
+			got, err := client.VerifyIDToken(provider.sign(t, "key-1", claims))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyIDToken error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Subject != claims.Subject || got.Email != claims.Email) {
+				t.Errorf("VerifyIDToken = %+v", got)
+			}
+		})
+	}
+}
+
+// a misconfigured client with an empty issuer still doesn't accept tokens without one
+func TestVerifyIDTokenEmptyIssuerConfigured(t *testing.T) {
+	provider := newFakeProvider(t)
+	client, clock := provider.client()
+	client.Issuers = []string{""}
+
+	claims := validClaims(clock.Now())
+	claims.Issuer = ""
+	if _, err := client.VerifyIDToken(provider.sign(t, "key-1", claims)); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken without iss = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestFlexBool(t *testing.T) {
+	for raw, want := range map[string]bool{`{"email_verified": "true"}`: true, `{"email_verified": "false"}`: false, `{"email_verified": true}`: true, `{"email_verified": 1}`: false, `{}`: false} {
+		var claims IDTokenClaims
+		if err := json.Unmarshal([]byte(raw), &claims); err != nil {
+			t.Fatalf("%s: %v", raw, err)
+		}
+		if bool(claims.EmailVerified) != want {
+			t.Errorf("%s: email_verified = %v, want %v", raw, claims.EmailVerified, want)
+		}
+	}
+}
+
+func TestVerifyIDTokenBadSignature(t *testing.T) {
+	provider := newFakeProvider(t)
+	client, clock := provider.client()
+
+	// same kid, but signed by a key this provider never published
+	other := newFakeProvider(t)
+	forged := other.sign(t, "key-1", validClaims(clock.Now()))
+	if _, err := client.VerifyIDToken(forged); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken with a forged signature = %v, want ErrInvalidIDToken", err)
+	}
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims(clock.Now()))
+	hs.Header["kid"] = "key-1"
+	raw, _ := hs.SignedString([]byte("secret"))
+	if _, err := client.VerifyIDToken(raw); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken with HS256 = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	provider := newFakeProvider(t)
+	client, clock := provider.client()
+
+	if _, err := client.VerifyIDToken(provider.sign(t, "key-1", validClaims(clock.Now()))); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if _, err := client.VerifyIDToken(provider.sign(t, "key-1", validClaims(clock.Now()))); err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if hits := provider.jwksHits.Load(); hits != 1 {
+		t.Fatalf("JWKS fetched %d times for one key, want 1", hits)
+	}
+
+	// the provider rotates; a token with the new kid refetches the cached keys
+	clock.Advance(minKeysRefetch)
+	provider.rotate(t, "key-2")
+	if _, err := client.VerifyIDToken(provider.sign(t, "key-2", validClaims(clock.Now()))); err != nil {
+		t.Fatalf("VerifyIDToken after rotation: %v", err)
+	}
+	if hits := provider.jwksHits.Load(); hits != 2 {
+		t.Errorf("JWKS fetched %d times after rotation, want 2", hits)
+	}
+
+	// unknown kids don't refetch more than once a minute
+	for i := 0; i < 5; i++ {
+		if _, err := client.VerifyIDToken(provider.sign(t, "key-1", validClaims(clock.Now()))); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("VerifyIDToken with a retired key = %v, want ErrInvalidIDToken", err)
+		}
+	}
+	if hits := provider.jwksHits.Load(); hits != 2 {
+		t.Errorf("JWKS fetched %d times for unknown kids within a minute, want 2", hits)
+	}
+
+	// keys expire with the max-age the provider sent
+	clock.Advance(time.Hour)
+	if _, err := client.VerifyIDToken(provider.sign(t, "key-2", validClaims(clock.Now()))); err != nil {
+		t.Fatalf("VerifyIDToken after the cache expired: %v", err)
+	}
+	if hits := provider.jwksHits.Load(); hits != 3 {
+		t.Errorf("JWKS fetched %d times after max-age, want 3", hits)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"public, max-age=19923, must-revalidate, no-transform", 19923 * time.Second},
+		{"MAX-AGE=60", time.Minute},
+		{"no-cache", defaultKeysTTL},
+		{"max-age=0", defaultKeysTTL},
+		{"max-age=abc", defaultKeysTTL},
+		{"", defaultKeysTTL},
+	}
+	for _, tt := range tests {
+		h := map[string][]string{"Cache-Control": {tt.header}}
+		if got := cacheMaxAge(h, defaultKeysTTL); got != tt.want {
+			t.Errorf("cacheMaxAge(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
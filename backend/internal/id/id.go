@@ -0,0 +1,101 @@
+// package id makes the IDs for every model, "<prefix>_<ulid>": sortable by creation time and unguessable
+package id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// Prefixes say what an ID refers to, which makes logs and support requests easier to read
+const (
+	User        = "user"
+	Notice      = "notice"
+	NoticeMedia = "noticemedia"
+	Media       = "media"
+	PushSub     = "sub"
+	Session     = "session"
+	Identity    = "identity"
+	Credential  = "credential"
+	Challenge   = "challenge"
+	APIToken    = "token"
+)
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var now = time.Now
+
+var (
+	mu sync.Mutex
+	// the last ID's timestamp and random part, so IDs from this process always increase
+	lastMs   uint64
+	lastRand [10]byte
+)
+
+// New returns a fresh ID with the given prefix, or a bare ULID if the prefix is empty. Rows from before
+// ULIDs have "<prefix>_<unix nanos>" IDs, so order by a timestamp column rather than by ID
+func New(prefix string) string {
+	ulid := newULID(now())
+	if prefix == "" {
+		return ulid
+	}
+	return prefix + "_" + ulid
+}
+
+// newULID is a 48-bit millisecond timestamp then 80 random bits. Within a millisecond (or if the clock steps
+// back) the random part of the last ID goes up by a random amount instead, moving on to the next millisecond
+// if it would overflow
+func newULID(t time.Time) string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ms := uint64(t.UnixMilli())
+	if ms <= lastMs {
+		ms = lastMs
+		if !incrementRandom(&lastRand) {
+			ms++
+			readRandom(lastRand[:])
+		}
+	} else {
+		readRandom(lastRand[:])
+	}
+	lastMs = ms
+
+	var b [16]byte
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], lastRand[:])
+
+	// 128 bits in 26 five-bit characters; the top two bits are always zero
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// incrementRandom adds a random 1 to 2^32 to r, so the next ID can't be guessed from this one; false if it overflowed
+func incrementRandom(r *[10]byte) bool {
+	var step [4]byte
+	readRandom(step[:])
+	carry := uint64(binary.BigEndian.Uint32(step[:])) + 1
+	for i := len(r) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(r[i]) + carry&0xFF
+		r[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	return carry == 0
+}
+
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand only fails if the OS can't supply randomness, and then nothing is safe to issue
+		panic("id: failed to read random bytes: " + err.Error())
+	}
+}
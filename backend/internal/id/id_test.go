@@ -0,0 +1,169 @@
+package id
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// freeze pins the clock for New and starts the monotonic state afresh
+func freeze(t *testing.T, at time.Time) *time.Time {
+	t.Helper()
+	clock := at
+	now = func() time.Time { return clock }
+	mu.Lock()
+	lastMs, lastRand = 0, [10]byte{}
+	mu.Unlock()
+	t.Cleanup(func() { now = time.Now })
+	return &clock
+}
+
+func TestNewFormat(t *testing.T) {
+	for _, prefix := range []string{User, Notice, ""} {
+		got := New(prefix)
+		ulid := got
+		if prefix != "" {
+			var ok bool
+			ulid, ok = strings.CutPrefix(got, prefix+"_")
+			if !ok {
+				t.Fatalf("New(%q) = %s, missing the prefix", prefix, got)
+			}
+		}
+		if len(ulid) != 26 {
+			t.Errorf("New(%q) = %s, want 26 characters after the prefix", prefix, got)
+		}
+		for _, c := range ulid {
+			if !strings.ContainsRune(crockford, c) {
+				t.Errorf("New(%q) = %s has %q, which isn't Crockford base32", prefix, got, c)
+			}
+		}
+		// 128 bits in 130: the first character only carries three
+		if ulid[0] > '7' {
+			t.Errorf("New(%q) = %s overflows 128 bits", prefix, got)
+		}
+	}
+}
+
+func TestNewTimestamp(t *testing.T) {
+	// the example from the ULID spec
+	freeze(t, time.UnixMilli(1469918176385))
+	if got := New(""); got[:10] != "01ARYZ6S41" {
+		t.Errorf("timestamp part = %s, want 01ARYZ6S41", got[:10])
+	}
+}
+
+func TestNewSortsAcrossMilliseconds(t *testing.T) {
+	clock := freeze(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	prev := New(Notice)
+	for _, step := range []time.Duration{time.Millisecond, time.Millisecond, time.Second, 24 * time.Hour, 10 * 365 * 24 * time.Hour} {
+		*clock = clock.Add(step)
+		next := New(Notice)
+		if next <= prev {
+			t.Errorf("after %v: %s <= %s", step, next, prev)
+		}
+		prev = next
+	}
+}
+
+func TestNewMonotonicWithinMillisecond(t *testing.T) {
+	freeze(t, time.Date(2025, 6, 1, 7, 30, 0, 0, time.UTC))
+	prev := New("")
+	for i := 0; i < 10000; i++ {
+		next := New("")
+		if next <= prev {
+			t.Fatalf("ID %d in the same millisecond didn't increase: %s <= %s", i, next, prev)
+		}
+		if next[:10] != prev[:10] {
+			t.Fatalf("timestamp moved within a millisecond: %s -> %s", prev, next)
+		}
+		prev = next
+	}
+}
+
+func TestNewRandomOverflow(t *testing.T) {
+	at := time.Date(2025, 6, 1, 7, 30, 0, 0, time.UTC)
+	freeze(t, at)
+	prev := New("")
+
+	// the random part is as high as it goes, so the next ID has to borrow the next millisecond
+	mu.Lock()
+	for i := range lastRand {
+		lastRand[i] = 0xFF
+	}
+	mu.Unlock()
+	next := New("")
+	if next <= prev {
+		t.Errorf("ID after overflow didn't increase: %s <= %s", next, prev)
+	}
+	if want := newULIDTimestamp(at.Add(time.Millisecond)); next[:10] != want {
+		t.Errorf("timestamp after overflow = %s, want the next millisecond %s", next[:10], want)
+	}
+
+	// and IDs keep increasing from there while the clock is still on the old millisecond
+	after := New("")
+	if after <= next || after[:10] != next[:10] {
+		t.Errorf("ID after the borrowed millisecond = %s, want above %s in the same millisecond", after, next)
+	}
+}
+
+func TestNewClockStepsBack(t *testing.T) {
+	clock := freeze(t, time.Date(2025, 6, 1, 7, 30, 0, 0, time.UTC))
+	prev := New("")
+	*clock = clock.Add(-time.Second)
+	if next := New(""); next <= prev {
+		t.Errorf("ID after the clock stepped back = %s, want above %s", next, prev)
+	}
+}
+
+func TestIncrementRandom(t *testing.T) {
+	r := [10]byte{9: 0x01}
+	if !incrementRandom(&r) {
+		t.Fatal("small value overflowed")
+	}
+	if r == [10]byte{9: 0x01} {
+		t.Error("incrementRandom didn't change the value")
+	}
+	// the step is at most 2^32, so only the last four bytes and a carry can change
+	if r[0] != 0 || r[1] != 0 || r[2] != 0 || r[3] != 0 || r[4] != 0 {
+		t.Errorf("step was too large: %x", r)
+	}
+
+	full := [10]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	if incrementRandom(&full) {
+		t.Error("incrementing the largest value didn't report overflow")
+	}
+}
+
+func TestNewConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	var seenMu sync.Mutex
+	seen := map[string]bool{}
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				id := New(Session)
+				seenMu.Lock()
+				if seen[id] {
+					t.Errorf("duplicate ID %s", id)
+				}
+				seen[id] = true
+				seenMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// newULIDTimestamp is the 10-character timestamp part for t
+func newULIDTimestamp(t time.Time) string {
+	ms := uint64(t.UnixMilli())
+	var out [10]byte
+	for i := 9; i >= 0; i-- {
+		out[i] = crockford[ms&31]
+		ms >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+type job struct {
+	name    string
+	run     func(ctx context.Context) error
+	onFail  func(err error)
+	attempt int
+}
+
+// Queue runs jobs on a fixed pool of workers, retrying failures with exponential backoff
+type Queue struct {
+	Workers     int
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Timeout     time.Duration
+
+	jobs chan *job
+	ctx  context.Context
+	wg   sync.WaitGroup
+}
+
+func NewQueue(workers, maxAttempts int) *Queue {
+	return &Queue{
+		Workers:     workers,
+		MaxAttempts: maxAttempts,
+		BaseDelay:   5 * time.Second,
+		MaxDelay:    10 * time.Minute,
+		Timeout:     30 * time.Second,
+		jobs:        make(chan *job, 256),
+	}
+}
+
+func (q *Queue) Start(ctx context.Context) {
+	q.ctx = ctx
+	for i := 0; i < q.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Wait blocks until the workers exit after the start context is cancelled
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Enqueue schedules run; onFail (optional) is called once retries are exhausted or the error is permanent
+func (q *Queue) Enqueue(name string, run func(ctx context.Context) error, onFail func(err error)) {
+	q.push(&job{name: name, run: run, onFail: onFail})
+}
+
+func (q *Queue) push(j *job) {
+	select {
+	case q.jobs <- j:
+	default:
+		// never block a request handler on a full queue
+		go func() {
+			select {
+			case q.jobs <- j:
+			case <-q.ctx.Done():
+			}
+		}()
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		case j := <-q.jobs:
+			q.run(j)
+		}
+	}
+}
+
+func (q *Queue) run(j *job) {
+	j.attempt++
+
+	ctx, cancel := context.WithTimeout(q.ctx, q.Timeout)
+	err := j.run(ctx)
+	cancel()
+	if err == nil {
+		return
+	}
+
+	if IsPermanent(err) || j.attempt >= q.MaxAttempts {
+		log.Printf("job %s failed after %d attempt(s): %v", j.name, j.attempt, err)
+		if j.onFail != nil {
+			j.onFail(err)
+		}
+		return
+	}
+
+	delay := q.backoff(j.attempt)
+	log.Printf("job %s failed (attempt %d/%d), retrying in %s: %v", j.name, j.attempt, q.MaxAttempts, delay, err)
+	time.AfterFunc(delay, func() {
+		if q.ctx.Err() == nil {
+			q.push(j)
+		}
+	})
+}
+
+// backoff doubles the delay each attempt, capped at MaxDelay, with up to 20% jitter so retries don't line up
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.BaseDelay
+	for i := 1; i < attempt && delay < q.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.MaxDelay {
+		delay = q.MaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
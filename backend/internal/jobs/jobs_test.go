@@ -0,0 +1,189 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// startQueue runs a queue with short delays for the length of the test
+func startQueue(t *testing.T, maxAttempts int) *Queue {
+	t.Helper()
+	q := NewQueue(2, maxAttempts)
+	q.BaseDelay = time.Millisecond
+	q.MaxDelay = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		q.Wait()
+	})
+	return q
+}
+
+// failed waits for a job's onFail
+func failed(t *testing.T, ch <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never gave up")
+		return nil
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := NewQueue(1, 10)
+	q.BaseDelay = time.Second
+	q.MaxDelay = 10 * time.Second
+
+	for attempt, base := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 9: 10 * time.Second, 60: 10 * time.Second} {
+		for i := 0; i < 50; i++ {
+			// up to 20% jitter on top, never below the base
+			if got := q.backoff(attempt); got < base || got > base+base/5 {
+				t.Fatalf("backoff(%d) = %v, want %v plus up to 20%%", attempt, got, base)
+			}
+		}
+	}
+}
+
+func TestRetriesUntilMaxAttempts(t *testing.T) {
+	q := startQueue(t, 3)
+	var attempts atomic.Int32
+	fail := make(chan error, 1)
+	boom := errors.New("upstream unavailable")
+
+	q.Enqueue("always fails", func(ctx context.Context) error {
+		attempts.Add(1)
+		return boom
+	}, func(err error) { fail <- err })
+
+	if err := failed(t, fail); err != boom {
+		t.Errorf("onFail got %v, want the job's error", err)
+	}
+	// give a stray fourth attempt the chance to show up
+	time.Sleep(20 * time.Millisecond)
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("ran %d times, want 3", n)
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	q := startQueue(t, 5)
+	var attempts atomic.Int32
+	done := make(chan struct{})
+
+	q.Enqueue("flaky", func(ctx context.Context) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("try again")
+		}
+		close(done)
+		return nil
+	}, func(err error) { t.Errorf("onFail called for a job that succeeded: %v", err) })
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job never succeeded")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("ran %d times, want 3", n)
+	}
+}
+
+func TestPermanentErrorIsNotRetried(t *testing.T) {
+	q := startQueue(t, 5)
+	var attempts atomic.Int32
+	fail := make(chan error, 1)
+
+	q.Enqueue("bad input", func(ctx context.Context) error {
+		attempts.Add(1)
+		return Permanent(errors.New("not a song link"))
+	}, func(err error) { fail <- err })
+
+	if err := failed(t, fail); !IsPermanent(err) {
+		t.Errorf("onFail got %v, want a permanent error", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("ran %d times, want 1", n)
+	}
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) isn't nil")
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	q := startQueue(t, 2)
+	q.Timeout = 20 * time.Millisecond
+	var attempts atomic.Int32
+	fail := make(chan error, 1)
+
+	q.Enqueue("hangs", func(ctx context.Context) error {
+		attempts.Add(1)
+		<-ctx.Done()
+		return ctx.Err()
+	}, func(err error) { fail <- err })
+
+	if err := failed(t, fail); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("onFail got %v, want DeadlineExceeded", err)
+	}
+	// a timeout is an ordinary failure, so it's retried
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("ran %d times, want 2", n)
+	}
+}
+
+func TestShutdownCancelsJobs(t *testing.T) {
+	q := NewQueue(1, 5)
+	q.BaseDelay = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Start(ctx)
+
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	q.Enqueue("long running", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return ctx.Err()
+	}, nil)
+
+	var retried atomic.Int32
+	q.Enqueue("fails once", func(ctx context.Context) error {
+		retried.Add(1)
+		return errors.New("try again")
+	}, nil)
+
+	<-started
+	cancel()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("running job saw %v, want Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("running job wasn't cancelled on shutdown")
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		q.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait didn't return after shutdown")
+	}
+
+	// retries due after shutdown are dropped rather than run
+	time.Sleep(50 * time.Millisecond)
+	if n := retried.Load(); n > 1 {
+		t.Errorf("job ran %d times after shutdown, want at most once", n)
+	}
+}
@@ -0,0 +1,314 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+type AudioFormat string
+
+const (
+	AudioOgg  AudioFormat = "ogg"
+	AudioWebM AudioFormat = "webm"
+	AudioM4A  AudioFormat = "m4a"
+)
+
+var AudioContentTypes = map[string]AudioFormat{
+	"audio/ogg":   AudioOgg,
+	"audio/opus":  AudioOgg,
+	"audio/webm":  AudioWebM,
+	"video/webm":  AudioWebM, // some browsers label audio-only recordings as video
+	"audio/mp4":   AudioM4A,
+	"audio/m4a":   AudioM4A,
+	"audio/x-m4a": AudioM4A,
+}
+
+func (f AudioFormat) Ext() string {
+	switch f {
+	case AudioOgg:
+		return ".opus"
+	case AudioWebM:
+		return ".webm"
+	case AudioM4A:
+		return ".m4a"
+	}
+	return ""
+}
+
+func (f AudioFormat) ContentType() string {
+	switch f {
+	case AudioOgg:
+		return "audio/ogg"
+	case AudioWebM:
+		return "audio/webm"
+	case AudioM4A:
+		return "audio/mp4"
+	}
+	return "application/octet-stream"
+}
+
+// SniffAudio detects the container from its magic bytes, ignoring whatever the client claims
+func SniffAudio(data []byte) (AudioFormat, error) {
+	switch {
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		return AudioOgg, nil
+	case len(data) >= 4 && bytes.Equal(data[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return AudioWebM, nil
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return AudioM4A, nil
+	}
+	return "", fmt.Errorf("unrecognised audio container")
+}
+
+// AudioDuration reads the playback length from the container headers
+func AudioDuration(format AudioFormat, data []byte) (time.Duration, error) {
+	switch format {
+	case AudioOgg:
+		return oggOpusDuration(data)
+	case AudioWebM:
+		return webmDuration(data)
+	case AudioM4A:
+		return mp4Duration(data)
+	}
+	return 0, fmt.Errorf("unsupported audio format: %s", format)
+}
+
+// opus always uses a 48kHz granule clock regardless of the input sample rate
+const opusGranuleRate = 48000
+
+func oggOpusDuration(data []byte) (time.Duration, error) {
+	var preSkip uint64
+	var lastGranule uint64
+	seenHead := false
+	found := false
+
+	for off := 0; off < len(data); {
+		if off+27 > len(data) || string(data[off:off+4]) != "OggS" {
+			return 0, fmt.Errorf("malformed ogg page at offset %d", off)
+		}
+		granule := binary.LittleEndian.Uint64(data[off+6 : off+14])
+		segments := int(data[off+26])
+		if off+27+segments > len(data) {
+			return 0, fmt.Errorf("truncated ogg page at offset %d", off)
+		}
+
+		bodyLen := 0
+		for _, n := range data[off+27 : off+27+segments] {
+			bodyLen += int(n)
+		}
+		bodyStart := off + 27 + segments
+		if bodyStart+bodyLen > len(data) {
+			return 0, fmt.Errorf("truncated ogg page at offset %d", off)
+		}
+
+		body := data[bodyStart : bodyStart+bodyLen]
+		if !seenHead {
+			if len(body) < 19 || string(body[:8]) != "OpusHead" {
+				return 0, fmt.Errorf("ogg stream is not opus")
+			}
+			preSkip = uint64(binary.LittleEndian.Uint16(body[10:12]))
+			seenHead = true
+		}
+
+		// -1 marks pages where no packet finishes
+		if granule != math.MaxUint64 {
+			lastGranule = granule
+			found = true
+		}
+		off = bodyStart + bodyLen
+	}
+
+	if !seenHead || !found {
+		return 0, fmt.Errorf("no opus audio found")
+	}
+	if lastGranule < preSkip {
+		return 0, nil
+	}
+	samples := lastGranule - preSkip
+	return time.Duration(samples) * time.Second / opusGranuleRate, nil
+}
+
+const (
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlCluster       = 0x1F43B675
+	ebmlTimecode      = 0xE7
+	ebmlBlockGroup    = 0xA0
+	ebmlBlock         = 0xA1
+	ebmlSimpleBlock   = 0xA3
+)
+
+// readVint decodes an EBML variable-length integer, keeping the length marker when raw is set (element IDs)
+func readVint(data []byte, raw bool) (value uint64, length int, unknown bool, err error) {
+	if len(data) == 0 {
+		return 0, 0, false, fmt.Errorf("unexpected end of data")
+	}
+	first := data[0]
+	length = 1
+	for mask := byte(0x80); mask != 0 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 || length > len(data) {
+		return 0, 0, false, fmt.Errorf("invalid vint")
+	}
+
+	value = uint64(first)
+	if !raw {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+		if b != 0xFF {
+			allOnes = false
+		}
+	}
+	return value, length, !raw && allOnes, nil
+}
+
+func readUint(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// webmDuration walks the element tree linearly, stepping into container elements instead of skipping them,
+// so recordings with unknown-size segments and clusters (as written by MediaRecorder) still parse
+func webmDuration(data []byte) (time.Duration, error) {
+	timecodeScale := uint64(1000000)
+	var duration float64
+	var clusterTimecode, maxTimecode int64
+	seenSegment := false
+
+	for off := 0; off < len(data); {
+		id, idLen, _, err := readVint(data[off:], true)
+		if err != nil {
+			break
+		}
+		size, sizeLen, unknown, err := readVint(data[off+idLen:], false)
+		if err != nil {
+			break
+		}
+		payload := off + idLen + sizeLen
+
+		switch id {
+		case ebmlSegment, ebmlInfo, ebmlCluster, ebmlBlockGroup:
+			if id == ebmlSegment {
+				seenSegment = true
+			}
+			off = payload
+			continue
+		}
+
+		if unknown || size > uint64(len(data)-payload) {
+			// a truncated trailing element is fine, we've already seen everything before it
+			break
+		}
+		body := data[payload : payload+int(size)]
+
+		switch id {
+		case ebmlTimecodeScale:
+			timecodeScale = readUint(body)
+		case ebmlDuration:
+			switch len(body) {
+			case 4:
+				duration = float64(math.Float32frombits(binary.BigEndian.Uint32(body)))
+			case 8:
+				duration = math.Float64frombits(binary.BigEndian.Uint64(body))
+			}
+		case ebmlTimecode:
+			clusterTimecode = int64(readUint(body))
+		case ebmlBlock, ebmlSimpleBlock:
+			_, trackLen, _, err := readVint(body, false)
+			if err == nil && len(body) >= trackLen+2 {
+				rel := int16(binary.BigEndian.Uint16(body[trackLen : trackLen+2]))
+				if t := clusterTimecode + int64(rel); t > maxTimecode {
+					maxTimecode = t
+				}
+			}
+		}
+		off = payload + int(size)
+	}
+
+	if !seenSegment {
+		return 0, fmt.Errorf("no webm segment found")
+	}
+	if duration > 0 {
+		return time.Duration(duration * float64(timecodeScale)), nil
+	}
+	return time.Duration(maxTimecode) * time.Duration(timecodeScale), nil
+}
+
+func mp4Duration(data []byte) (time.Duration, error) {
+	moov, err := findBox(data, "moov")
+	if err != nil {
+		return 0, err
+	}
+	mvhd, err := findBox(moov, "mvhd")
+	if err != nil {
+		return 0, err
+	}
+	if len(mvhd) < 4 {
+		return 0, fmt.Errorf("malformed mvhd box")
+	}
+
+	var timescale, duration uint64
+	switch mvhd[0] {
+	case 0:
+		if len(mvhd) < 20 {
+			return 0, fmt.Errorf("malformed mvhd box")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(mvhd[16:20]))
+	case 1:
+		if len(mvhd) < 32 {
+			return 0, fmt.Errorf("malformed mvhd box")
+		}
+		timescale = uint64(binary.BigEndian.Uint32(mvhd[20:24]))
+		duration = binary.BigEndian.Uint64(mvhd[24:32])
+	default:
+		return 0, fmt.Errorf("unsupported mvhd version %d", mvhd[0])
+	}
+	if timescale == 0 {
+		return 0, fmt.Errorf("invalid mvhd timescale")
+	}
+
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+}
+
+// findBox returns the payload of the first child box of the given type
+func findBox(data []byte, boxType string) ([]byte, error) {
+	for off := 0; off+8 <= len(data); {
+		size := uint64(binary.BigEndian.Uint32(data[off : off+4]))
+		typ := string(data[off+4 : off+8])
+		header := uint64(8)
+
+		switch size {
+		case 0:
+			size = uint64(len(data) - off)
+		case 1:
+			if off+16 > len(data) {
+				return nil, fmt.Errorf("truncated %s box", typ)
+			}
+			size = binary.BigEndian.Uint64(data[off+8 : off+16])
+			header = 16
+		}
+		// compared against the bytes left rather than off+size, which a 64-bit size can wrap
+		if size < header || size > uint64(len(data)-off) {
+			return nil, fmt.Errorf("malformed %s box", typ)
+		}
+
+		if typ == boxType {
+			return data[off+int(header) : off+int(size)], nil
+		}
+		off += int(size)
+	}
+	return nil, fmt.Errorf("no %s box found", boxType)
+}
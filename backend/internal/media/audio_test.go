@@ -0,0 +1,153 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func oggPage(granule uint64, body []byte) []byte {
+	var page bytes.Buffer
+	page.WriteString("OggS")
+	page.Write([]byte{0, 0})
+	binary.Write(&page, binary.LittleEndian, granule)
+	page.Write(make([]byte, 12)) // serial, sequence, crc
+	var segments []byte
+	for n := len(body); ; n -= 255 {
+		if n < 255 {
+			segments = append(segments, byte(n))
+			break
+		}
+		segments = append(segments, 255)
+	}
+	page.WriteByte(byte(len(segments)))
+	page.Write(segments)
+	page.Write(body)
+	return page.Bytes()
+}
+
+func testOgg(seconds int) []byte {
+	head := []byte("OpusHead")
+	head = append(head, 1, 1)
+	head = binary.LittleEndian.AppendUint16(head, 312)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0)
+
+	data := oggPage(0, head)
+	data = append(data, oggPage(math.MaxUint64, []byte("OpusTags"))...)
+	data = append(data, oggPage(uint64(312+seconds*opusGranuleRate), make([]byte, 100))...)
+	return data
+}
+
+func ebml(id []byte, body []byte) []byte {
+	out := append([]byte{}, id...)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01 // 8-byte vint marker
+	out = append(out, size...)
+	return append(out, body...)
+}
+
+func testWebM(seconds float64) []byte {
+	duration := make([]byte, 8)
+	binary.BigEndian.PutUint64(duration, math.Float64bits(seconds*1000))
+	info := append(ebml([]byte{0x2A, 0xD7, 0xB1}, []byte{0x0F, 0x42, 0x40}), ebml([]byte{0x44, 0x89}, duration)...)
+
+	data := ebml([]byte{0x1A, 0x45, 0xDF, 0xA3}, []byte{0x42, 0x86, 0x81, 0x01})
+	// MediaRecorder writes the segment with an unknown size
+	data = append(data, 0x18, 0x53, 0x80, 0x67, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	return append(data, ebml([]byte{0x15, 0x49, 0xA9, 0x66}, info)...)
+}
+
+func box(typ string, body []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	out = append(out, typ...)
+	return append(out, body...)
+}
+
+func testM4A(seconds int) []byte {
+	mvhd := make([]byte, 20)
+	binary.BigEndian.PutUint32(mvhd[12:16], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:20], uint32(seconds*1000))
+	return append(box("ftyp", []byte("M4A \x00\x00\x00\x00")), box("moov", box("mvhd", mvhd))...)
+}
+
+func TestAudioDuration(t *testing.T) {
+	tests := []struct {
+		name   string
+		format AudioFormat
+		data   []byte
+		want   time.Duration
+	}{
+		{"ogg", AudioOgg, testOgg(12), 12 * time.Second},
+		{"webm", AudioWebM, testWebM(7.5), 7500 * time.Millisecond},
+		{"m4a", AudioM4A, testM4A(30), 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, err := SniffAudio(tt.data)
+			if err != nil || format != tt.format {
+				t.Fatalf("SniffAudio = %q, %v; want %q", format, err, tt.format)
+			}
+			got, err := AudioDuration(tt.format, tt.data)
+			if err != nil {
+				t.Fatalf("AudioDuration: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("AudioDuration = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudioDurationMalformed(t *testing.T) {
+	ogg := testOgg(12)
+	webm := testWebM(7.5)
+	m4a := testM4A(30)
+
+	hugeSegment := append([]byte{}, ogg...)
+	hugeSegment[26] = 255 // claims far more segments than the page has
+
+	hugeElement := append([]byte{}, webm[:len(webm)-50]...)
+	hugeElement = append(hugeElement, 0x44, 0x89, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE)
+
+	wrapping := append([]byte{}, m4a[:16]...)
+	wrapping = append(wrapping, 0, 0, 0, 1, 'm', 'o', 'o', 'v', 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	negative := append([]byte{}, m4a[:16]...)
+	negative = append(negative, 0, 0, 0, 1, 'f', 'r', 'e', 'e', 0x80, 0, 0, 0, 0, 0, 0, 0)
+	negative = append(negative, box("moov", nil)...)
+	tooShort := append([]byte{}, m4a...)
+	binary.BigEndian.PutUint32(tooShort[16:20], 4) // moov smaller than its own header
+
+	tests := []struct {
+		name   string
+		format AudioFormat
+		data   []byte
+	}{
+		{"ogg truncated header", AudioOgg, ogg[:20]},
+		{"ogg truncated body", AudioOgg, ogg[:len(ogg)-10]},
+		{"ogg segment table overflow", AudioOgg, hugeSegment[:40]},
+		{"webm truncated before segment", AudioWebM, webm[:6]},
+		{"webm oversized element", AudioWebM, hugeElement},
+		{"m4a truncated moov", AudioM4A, m4a[:len(m4a)-4]},
+		{"m4a truncated largesize", AudioM4A, append(append([]byte{}, m4a[:16]...), 0, 0, 0, 1, 'm', 'o', 'o', 'v')},
+		{"m4a wrapping largesize", AudioM4A, wrapping},
+		{"m4a negative offset", AudioM4A, negative},
+		{"m4a box smaller than header", AudioM4A, tooShort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("AudioDuration panicked: %v", r)
+				}
+			}()
+			// a truncated trailing webm element is tolerated, so only the absence of a panic matters there
+			if _, err := AudioDuration(tt.format, tt.data); err == nil && tt.format != AudioWebM {
+				t.Error("AudioDuration succeeded on malformed input")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"good_morning_backend/internal/models"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type GCConfig struct {
+	MaxAge   time.Duration
+	Interval time.Duration
+	DryRun   bool
+}
+
+func GCConfigFromEnv() GCConfig {
+	cfg := GCConfig{
+		MaxAge:   24 * time.Hour,
+		Interval: time.Hour,
+	}
+	if v, err := time.ParseDuration(os.Getenv("MEDIA_GC_MAX_AGE")); err == nil && v > 0 {
+		cfg.MaxAge = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("MEDIA_GC_INTERVAL")); err == nil && v > 0 {
+		cfg.Interval = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("MEDIA_GC_DRY_RUN")); err == nil {
+		cfg.DryRun = v
+	}
+	return cfg
+}
+
+// StartGC periodically removes uploads that were never attached to a notice
+func StartGC(ctx context.Context, db *gorm.DB, cfg GCConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			if n, err := CollectOrphans(ctx, db, cfg.MaxAge, cfg.DryRun); err != nil {
+				log.Printf("media gc failed: %v", err)
+			} else if n > 0 {
+				if cfg.DryRun {
+					log.Printf("media gc (dry run): would delete %d orphaned uploads", n)
+				} else {
+					log.Printf("media gc: deleted %d orphaned uploads", n)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CollectOrphans deletes unattached media older than maxAge, returning how many were (or would be) removed
+func CollectOrphans(ctx context.Context, db *gorm.DB, maxAge time.Duration, dryRun bool) (int, error) {
+	var orphans []models.Media
+	err := db.WithContext(ctx).
+		Where("attached_at IS NULL AND created_at < ?", time.Now().Add(-maxAge)).
+		Find(&orphans).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if dryRun {
+		for _, m := range orphans {
+			log.Printf("media gc (dry run): would delete %s (%s, owner %s)", m.ID, m.Key, m.OwnerID)
+		}
+		return len(orphans), nil
+	}
+
+	deleted := 0
+	for _, m := range orphans {
+		ok, err := collectOrphan(ctx, db, m)
+		if err != nil {
+			log.Printf("media gc: failed to delete %s: %v", m.ID, err)
+			continue
+		}
+		if ok {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// collectOrphan removes the stored file before its record, so a storage failure leaves the record for the
+// next run to retry. The row stays locked meanwhile, so a notice created mid-run can't attach it and then
+// find the file gone; its attach waits, matches nothing and fails instead
+func collectOrphan(ctx context.Context, db *gorm.DB, m models.Media) (bool, error) {
+	deleted := false
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var locked models.Media
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND attached_at IS NULL", m.ID).
+			First(&locked).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := Store.Delete(ctx, locked.Key); err != nil {
+			return err
+		}
+		if err := tx.Delete(&locked).Error; err != nil {
+			return err
+		}
+		deleted = true
+		return nil
+	})
+	return deleted, err
+}
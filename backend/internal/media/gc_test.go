@@ -0,0 +1,160 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"good_morning_backend/internal/dbtest"
+	"good_morning_backend/internal/models"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// recordingStorage remembers what was deleted and can be told to fail
+type recordingStorage struct {
+	mu      sync.Mutex
+	deleted []string
+	fail    bool
+}
+
+func (s *recordingStorage) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	return "https://media.example/" + key, nil
+}
+
+func (s *recordingStorage) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail {
+		return errors.New("storage unavailable")
+	}
+	s.deleted = append(s.deleted, key)
+	return nil
+}
+
+func (s *recordingStorage) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := append([]string(nil), s.deleted...)
+	sort.Strings(keys)
+	return keys
+}
+
+// seedMedia stores one upload per case; only old, unattached ones are orphans, whoever owns them
+func seedMedia(t *testing.T) (*gorm.DB, *recordingStorage) {
+	t.Helper()
+	db := dbtest.Open(t, &models.Media{})
+
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	notice := "notice_1"
+	uploads := []models.Media{
+		{ID: "media_orphan_a", OwnerID: "user_a", CreatedAt: old},
+		{ID: "media_orphan_b", OwnerID: "user_b", CreatedAt: old},
+		{ID: "media_attached_a", OwnerID: "user_a", CreatedAt: old, NoticeID: &notice, AttachedAt: &recent},
+		{ID: "media_attached_b", OwnerID: "user_b", CreatedAt: old, NoticeID: &notice, AttachedAt: &recent},
+		{ID: "media_recent_a", OwnerID: "user_a", CreatedAt: recent},
+		{ID: "media_recent_b", OwnerID: "user_b", CreatedAt: recent},
+	}
+	for i := range uploads {
+		m := &uploads[i]
+		m.Kind = "photo"
+		m.Key = "photos/" + m.ID + ".jpg"
+		m.URL = "https://media.example/" + m.Key
+		m.ContentType = "image/jpeg"
+		if err := db.Create(m).Error; err != nil {
+			t.Fatalf("seeding %s: %v", m.ID, err)
+		}
+	}
+
+	store := &recordingStorage{}
+	previous := Store
+	Store = store
+	t.Cleanup(func() { Store = previous })
+	return db, store
+}
+
+func remainingMedia(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var ids []string
+	if err := db.Model(&models.Media{}).Order("id").Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestCollectOrphans(t *testing.T) {
+	db, store := seedMedia(t)
+
+	n, err := CollectOrphans(context.Background(), db, 24*time.Hour, false)
+	if err != nil {
+		t.Fatalf("CollectOrphans: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("deleted %d, want 2", n)
+	}
+	if got, want := store.keys(), []string{"photos/media_orphan_a.jpg", "photos/media_orphan_b.jpg"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("deleted files %v, want %v", got, want)
+	}
+	// attached and recent uploads survive for both owners
+	want := []string{"media_attached_a", "media_attached_b", "media_recent_a", "media_recent_b"}
+	if got := remainingMedia(t, db); !reflect.DeepEqual(got, want) {
+		t.Errorf("remaining %v, want %v", got, want)
+	}
+
+	// nothing left to collect
+	if n, err := CollectOrphans(context.Background(), db, 24*time.Hour, false); err != nil || n != 0 {
+		t.Errorf("second run = %d, %v; want 0", n, err)
+	}
+}
+
+func TestCollectOrphansDryRun(t *testing.T) {
+	db, store := seedMedia(t)
+
+	n, err := CollectOrphans(context.Background(), db, 24*time.Hour, true)
+	if err != nil {
+		t.Fatalf("CollectOrphans: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("would delete %d, want 2", n)
+	}
+	if got := store.keys(); len(got) != 0 {
+		t.Errorf("dry run deleted files %v", got)
+	}
+	if got := remainingMedia(t, db); len(got) != 6 {
+		t.Errorf("dry run deleted records, %v left", got)
+	}
+}
+
+func TestCollectOrphansKeepsRecordWhenStorageFails(t *testing.T) {
+	db, store := seedMedia(t)
+	store.fail = true
+
+	if n, err := CollectOrphans(context.Background(), db, 24*time.Hour, false); err != nil || n != 0 {
+		t.Fatalf("CollectOrphans = %d, %v; want 0 deleted", n, err)
+	}
+	// the records stay so the next run retries the files
+	if got := remainingMedia(t, db); len(got) != 6 {
+		t.Errorf("records removed without their files, %v left", got)
+	}
+}
+
+func TestGCConfigFromEnv(t *testing.T) {
+	t.Setenv("MEDIA_GC_MAX_AGE", "")
+	t.Setenv("MEDIA_GC_INTERVAL", "")
+	t.Setenv("MEDIA_GC_DRY_RUN", "")
+	if cfg := GCConfigFromEnv(); cfg != (GCConfig{MaxAge: 24 * time.Hour, Interval: time.Hour}) {
+		t.Errorf("defaults = %+v", cfg)
+	}
+
+	t.Setenv("MEDIA_GC_MAX_AGE", "72h")
+	t.Setenv("MEDIA_GC_INTERVAL", "-5m")
+	t.Setenv("MEDIA_GC_DRY_RUN", "true")
+	if cfg := GCConfigFromEnv(); cfg != (GCConfig{MaxAge: 72 * time.Hour, Interval: time.Hour, DryRun: true}) {
+		t.Errorf("from env = %+v", cfg)
+	}
+}
@@ -0,0 +1,44 @@
+package media
+
+import (
+	"net/http"
+)
+
+// heifBrands maps ISO base media ftyp brands to the image type they identify; iPhones save photos as heic
+var heifBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"hevc": "image/heic",
+	"hevx": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif",
+}
+
+// SniffImage detects an image's content type from its bytes. net/http doesn't know HEIF, so that's
+// recognised from the ftyp box: the major brand decides, unless it's a generic HEIF brand, in which case
+// a HEVC brand among the compatible ones makes it heic
+func SniffImage(data []byte) string {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return http.DetectContentType(data)
+	}
+
+	contentType, ok := heifBrands[string(data[8:12])]
+	if !ok {
+		return http.DetectContentType(data)
+	}
+	if contentType == "image/heif" {
+		size := int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if size > len(data) {
+			size = len(data)
+		}
+		// compatible brands follow the major brand and its 4-byte minor version
+		for off := 16; off+4 <= size; off += 4 {
+			if heifBrands[string(data[off:off+4])] == "image/heic" {
+				return "image/heic"
+			}
+		}
+	}
+	return contentType
+}
@@ -0,0 +1,35 @@
+package media
+
+import "testing"
+
+func ftyp(major string, compatible ...string) []byte {
+	body := append([]byte(major), 0, 0, 0, 0)
+	for _, brand := range compatible {
+		body = append(body, brand...)
+	}
+	return append(box("ftyp", body), box("meta", nil)...)
+}
+
+func TestSniffImage(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"jpeg", []byte("\xFF\xD8\xFF\xE0\x00\x10JFIF\x00"), "image/jpeg"},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), "image/png"},
+		{"iphone heic", ftyp("heic", "mif1", "heic"), "image/heic"},
+		{"generic heif with hevc", ftyp("mif1", "mif1", "heic"), "image/heic"},
+		{"generic heif", ftyp("mif1", "mif1"), "image/heif"},
+		{"avif is not heif", ftyp("avif", "mif1", "miaf"), "application/octet-stream"},
+		{"m4a", ftyp("M4A ", "isom"), "application/octet-stream"},
+		{"short ftyp", []byte("\x00\x00\x00\x18ftypmif1"), "image/heif"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SniffImage(tt.data); got != tt.want {
+				t.Errorf("SniffImage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, body io.Reader) (string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var Store Storage
+
+// LocalStorage keeps uploads on disk, served by the backend under PublicURL; handy for development
+type LocalStorage struct {
+	Dir       string
+	PublicURL string
+}
+
+// InitStorage picks where uploads go from MEDIA_STORAGE: r2 (the default) or local
+func InitStorage() error {
+	switch backend := os.Getenv("MEDIA_STORAGE"); backend {
+	case "", "r2":
+		r2 := &R2Storage{
+			Endpoint:        os.Getenv("R2_ENDPOINT"),
+			Region:          os.Getenv("R2_REGION"),
+			Bucket:          os.Getenv("R2_BUCKET_NAME"),
+			AccessKeyID:     os.Getenv("R2_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("R2_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("R2_PUBLIC_URL"),
+		}
+		if r2.Region == "" {
+			r2.Region = "auto"
+		}
+		if r2.Endpoint == "" || r2.Bucket == "" || r2.AccessKeyID == "" || r2.SecretAccessKey == "" || r2.PublicURL == "" {
+			return fmt.Errorf("R2 storage needs R2_ENDPOINT, R2_BUCKET_NAME, R2_ACCESS_KEY_ID, R2_SECRET_ACCESS_KEY and R2_PUBLIC_URL (or set MEDIA_STORAGE=local)")
+		}
+		Store = r2
+	case "local":
+		dir := os.Getenv("MEDIA_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		publicURL := os.Getenv("MEDIA_PUBLIC_URL")
+		if publicURL == "" {
+			publicURL = "http://localhost:24804/media"
+		}
+		Store = &LocalStorage{Dir: dir, PublicURL: strings.TrimSuffix(publicURL, "/")}
+	default:
+		return fmt.Errorf("unknown MEDIA_STORAGE %q", backend)
+	}
+	return nil
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid media key: %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key, contentType string, body io.Reader) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	return s.PublicURL + "/" + strings.TrimPrefix(key, "/"), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
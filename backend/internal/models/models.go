@@ -7,36 +7,209 @@ import (
 )
 
 type User struct {
-	ID                   string    `gorm:"primaryKey" json:"id"`
-	Timezone             string    `json:"timezone"`
-	Username             string    `json:"username"`
-	Email                string    `json:"email"`
-	GoogleID             string    `json:"googleId"`
-	UniqueCode           string    `json:"uniqueCode"`
-	NotificationsEnabled bool      `json:"notificationsEnabled"`
-	PairedUserID         *string   `json:"pairedUserId"`
-	Picture              *string   `json:"picture"`
-	CreatedAt            time.Time `json:"createdAt"`
-	UpdatedAt            time.Time `json:"updatedAt"`
+	ID                    string     `gorm:"primaryKey" json:"id"`
+	Timezone              string     `json:"timezone"`
+	Username              string     `json:"username"`
+	Email                 string     `json:"email"`
+	GoogleID              string     `json:"-"` // Deprecated: superseded by Identity, read only by the migration
+	UniqueCode            string     `json:"uniqueCode"`
+	NotificationsEnabled  bool       `json:"notificationsEnabled"`
+	PreferredMusicService *string    `json:"preferredMusicService"`
+	PairedUserID          *string    `json:"pairedUserId"`
+	Picture               *string    `json:"picture"`
+	DeleteAfter           *time.Time `gorm:"index" json:"deleteAfter"` // set while an account deletion can still be cancelled
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
 }
 
 type Notice struct {
+	ID                string            `gorm:"primaryKey" json:"id"`
+	SenderID          string            `json:"senderId"`
+	RecipientID       string            `json:"recipientId"`
+	Message           *string           `json:"message"`
+	PhotoURL          *string           `json:"photoUrl"`
+	SongURL           *string           `json:"songUrl"`
+	SongProvider      *string           `json:"songProvider"`
+	SongID            *string           `json:"songId"`
+	SongKind          *string           `json:"songKind"`
+	SongLinks         map[string]string `gorm:"type:jsonb;serializer:json" json:"songLinks"`
+	PreferredSongURL  *string           `gorm:"-" json:"preferredSongUrl"`
+	MetadataStatus    string            `gorm:"not null;default:none;index" json:"metadataStatus"`
+	LinkURL           *string           `json:"linkUrl"`
+	LinkTitle         *string           `json:"linkTitle"`
+	LinkDescription   *string           `json:"linkDescription"`
+	LinkImage         *string           `json:"linkImage"`
+	LinkSiteName      *string           `json:"linkSiteName"`
+	LinkStatus        string            `gorm:"not null;default:none" json:"linkStatus"`
+	SongTitle         *string           `json:"songTitle"`
+	SongArtist        *string           `json:"songArtist"`
+	SongAlbumCover    *string           `json:"songAlbumCover"`
+	SongArtists       []string          `gorm:"type:jsonb;serializer:json" json:"songArtists"`
+	SongAlbum         *string           `json:"songAlbum"`
+	SongImages        []SongImage       `gorm:"type:jsonb;serializer:json" json:"songImages"`
+	SongDurationMs    *int              `json:"songDurationMs"`
+	SongExplicit      *bool             `json:"songExplicit"`
+	SongPreviewURL    *string           `json:"songPreviewUrl"`
+	SongISRC          *string           `json:"songIsrc"`
+	SongExplanation   *string           `json:"songExplanation"`
+	LyricQuote        *LyricQuote       `gorm:"type:jsonb;serializer:json" json:"lyricQuote"`
+	VoiceNoteURL      *string           `json:"voiceNoteUrl"`
+	VoiceNoteDuration *float64          `json:"voiceNoteDuration"`
+	ForegroundColor   string            `json:"foregroundColor"`
+	BackgroundColor   string            `json:"backgroundColor"`
+	Reactions         []string          `gorm:"type:text[]" json:"reactions"`
+	SentAt            time.Time         `json:"sentAt"`
+	EditedAt          *time.Time        `json:"editedAt"`
+	ResetAt           time.Time         `json:"resetAt"`
+	Media             []NoticeMedia     `gorm:"foreignKey:NoticeID" json:"media"`
+}
+
+// LyricQuote is the line of the song that made the sender think of their partner
+type LyricQuote struct {
+	Text        string `json:"text"`
+	TimestampMs *int   `json:"timestampMs"`
+}
+
+type SongImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type NoticeMedia struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	NoticeID  string    `gorm:"not null;index" json:"noticeId"`
+	MediaID   string    `gorm:"index" json:"mediaId"`
+	Position  int       `gorm:"not null" json:"position"`
+	URL       string    `gorm:"not null" json:"url"`
+	Caption   *string   `json:"caption"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type Media struct {
 	ID              string     `gorm:"primaryKey" json:"id"`
-	SenderID        string     `json:"senderId"`
-	RecipientID     string     `json:"recipientId"`
-	Message         *string    `json:"message"`
-	PhotoURL        *string    `json:"photoUrl"`
-	SongURL         *string    `json:"songUrl"`
-	SongTitle       *string    `json:"songTitle"`
-	SongArtist      *string    `json:"songArtist"`
-	SongAlbumCover  *string    `json:"songAlbumCover"`
-	SongExplanation *string    `json:"songExplanation"`
-	ForegroundColor string     `json:"foregroundColor"`
-	BackgroundColor string     `json:"backgroundColor"`
-	Reactions       []string   `gorm:"type:text[]" json:"reactions"`
-	SentAt          time.Time  `json:"sentAt"`
-	EditedAt        *time.Time `json:"editedAt"`
-	ResetAt         time.Time  `json:"resetAt"`
+	OwnerID         string     `gorm:"not null;index" json:"ownerId"`
+	Kind            string     `gorm:"not null" json:"kind"`
+	Key             string     `gorm:"not null;uniqueIndex" json:"-"`
+	URL             string     `gorm:"not null;uniqueIndex" json:"url"`
+	ContentType     string     `gorm:"not null" json:"contentType"`
+	Size            int64      `json:"size"`
+	DurationSeconds *float64   `json:"durationSeconds"`
+	NoticeID        *string    `gorm:"index" json:"noticeId"`
+	AttachedAt      *time.Time `gorm:"index" json:"attachedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// SpotifyAccount links a user's own Spotify account for the "good morning" playlist; tokens are sealed at rest
+type SpotifyAccount struct {
+	UserID        string    `gorm:"primaryKey" json:"userId"`
+	SpotifyUserID string    `gorm:"not null" json:"spotifyUserId"`
+	DisplayName   string    `json:"displayName"`
+	RefreshToken  string    `gorm:"not null" json:"-"`
+	PlaylistID    *string   `json:"playlistId"`
+	PlaylistURL   *string   `json:"playlistUrl"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// LinkPreview caches unfurled pages by URL so the same link isn't fetched for every notice
+type LinkPreview struct {
+	URL         string    `gorm:"primaryKey" json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Image       string    `json:"image"`
+	SiteName    string    `json:"siteName"`
+	Error       *string   `json:"error"`
+	FetchedAt   time.Time `json:"fetchedAt"`
+}
+
+// Identity links a login method to a user; a user can sign in with several
+type Identity struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"not null;index" json:"userId"`
+	Provider   string     `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"provider"`
+	Subject    string     `gorm:"not null;uniqueIndex:idx_identity_provider_subject" json:"-"`
+	Email      string     `json:"email"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// LoginToken is a pending email magic link; only the hash of the emailed token is stored.
+// UserID is set when a signed-in user asked to link the address, rather than sign in with it
+type LoginToken struct {
+	TokenHash string     `gorm:"primaryKey" json:"-"`
+	Email     string     `gorm:"not null;index" json:"email"`
+	UserID    *string    `gorm:"index" json:"userId"`
+	ReturnTo  string     `json:"returnTo"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// Credential is a registered passkey; CredentialID and PublicKey come from the authenticator
+type Credential struct {
+	ID              string     `gorm:"primaryKey" json:"id"`
+	UserID          string     `gorm:"not null;index" json:"userId"`
+	Name            string     `json:"name"`
+	CredentialID    []byte     `gorm:"not null;uniqueIndex" json:"-"`
+	PublicKey       []byte     `gorm:"not null" json:"-"`
+	AttestationType string     `json:"-"`
+	Transports      []string   `gorm:"type:jsonb;serializer:json" json:"transports"`
+	AAGUID          []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	UserVerified    bool       `json:"-"`
+	BackupEligible  bool       `json:"-"`
+	BackupState     bool       `json:"backedUp"`
+	LastUsedAt      *time.Time `json:"lastUsedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// WebAuthnChallenge holds a registration or login ceremony between its begin and finish requests
+type WebAuthnChallenge struct {
+	ID        string    `gorm:"primaryKey" json:"id"`
+	UserID    *string   `gorm:"index" json:"userId"`
+	Kind      string    `gorm:"not null" json:"kind"`
+	Data      []byte    `gorm:"not null" json:"-"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// APIToken is a personal access token for scripts; only its hash is stored, Prefix is kept to tell tokens apart
+type APIToken struct {
+	ID         string     `gorm:"primaryKey" json:"id"`
+	UserID     string     `gorm:"not null;index" json:"userId"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null" json:"prefix"`
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"type:jsonb;serializer:json" json:"scopes"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Session is one signed-in device; its refresh token rotates on every use and only its hash is stored
+type Session struct {
+	ID                  string     `gorm:"primaryKey" json:"id"`
+	UserID              string     `gorm:"not null;index" json:"userId"`
+	RefreshTokenHash    string     `gorm:"not null" json:"-"`
+	PreviousRefreshHash *string    `json:"-"`
+	RotatedAt           time.Time  `json:"-"`
+	Device              string     `json:"device"`
+	UserAgent           string     `json:"userAgent"`
+	IP                  string     `json:"ip"`
+	LastSeenAt          time.Time  `json:"lastSeenAt"`
+	ExpiresAt           time.Time  `gorm:"index" json:"expiresAt"`
+	RevokedAt           *time.Time `json:"revokedAt"`
+	CreatedAt           time.Time  `json:"createdAt"`
+}
+
+// RateLimitBucket is a token bucket for the Postgres rate limit store
+type RateLimitBucket struct {
+	Key       string    `gorm:"primaryKey"`
+	Tokens    float64   `gorm:"not null"`
+	Allowed   bool      `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null;index"`
 }
 
 type PushSubscription struct {
@@ -68,6 +241,50 @@ func (Notice) TableName() string {
 	return "Notice"
 }
 
+func (NoticeMedia) TableName() string {
+	return "NoticeMedia"
+}
+
+func (Media) TableName() string {
+	return "Media"
+}
+
+func (SpotifyAccount) TableName() string {
+	return "SpotifyAccount"
+}
+
+func (LinkPreview) TableName() string {
+	return "LinkPreview"
+}
+
+func (Identity) TableName() string {
+	return "Identity"
+}
+
+func (LoginToken) TableName() string {
+	return "LoginToken"
+}
+
+func (Credential) TableName() string {
+	return "Credential"
+}
+
+func (WebAuthnChallenge) TableName() string {
+	return "WebAuthnChallenge"
+}
+
+func (APIToken) TableName() string {
+	return "APIToken"
+}
+
+func (Session) TableName() string {
+	return "Session"
+}
+
+func (RateLimitBucket) TableName() string {
+	return "RateLimitBucket"
+}
+
 func (PushSubscription) TableName() string {
 	return "PushSubscription"
 }
@@ -0,0 +1,193 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultITunesAPIURL     = "https://itunes.apple.com"
+	DefaultAppleMusicAPIURL = "https://api.music.apple.com/v1"
+)
+
+// AppleMusic resolves music.apple.com links through the public iTunes lookup API.
+// ISRC search needs the Apple Music catalog API, so it only works with a developer token.
+type AppleMusic struct {
+	APIURL         string
+	CatalogURL     string
+	DeveloperToken string
+	Storefront     string
+	HTTPClient     *http.Client
+}
+
+func NewAppleMusic() *AppleMusic {
+	storefront := os.Getenv("APPLE_MUSIC_STOREFRONT")
+	if storefront == "" {
+		storefront = "us"
+	}
+	return &AppleMusic{
+		APIURL:         DefaultITunesAPIURL,
+		CatalogURL:     DefaultAppleMusicAPIURL,
+		DeveloperToken: os.Getenv("APPLE_MUSIC_DEVELOPER_TOKEN"),
+		Storefront:     storefront,
+		HTTPClient:     defaultHTTPClient,
+	}
+}
+
+func (a *AppleMusic) Name() string {
+	return "apple_music"
+}
+
+// Match handles /{country}/song/{slug}/{id} and album links with a ?i={trackId} selection
+func (a *AppleMusic) Match(rawURL string) (string, bool) {
+	u, ok := parseHostURL(rawURL, "music.apple.com")
+	if !ok {
+		return "", false
+	}
+
+	if id := u.Query().Get("i"); id != "" {
+		return numericID(id)
+	}
+
+	segments := pathSegments(u)
+	for i, s := range segments {
+		if s == "song" && i+1 < len(segments) {
+			return numericID(segments[len(segments)-1])
+		}
+	}
+	return "", false
+}
+
+func numericID(s string) (string, bool) {
+	if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+type itunesResult struct {
+	TrackID           int64  `json:"trackId"`
+	TrackName         string `json:"trackName"`
+	ArtistName        string `json:"artistName"`
+	CollectionName    string `json:"collectionName"`
+	TrackViewURL      string `json:"trackViewUrl"`
+	ArtworkURL100     string `json:"artworkUrl100"`
+	TrackTimeMillis   int    `json:"trackTimeMillis"`
+	TrackExplicitness string `json:"trackExplicitness"`
+	PreviewURL        string `json:"previewUrl"`
+}
+
+type itunesResponse struct {
+	ResultCount int            `json:"resultCount"`
+	Results     []itunesResult `json:"results"`
+}
+
+func (a *AppleMusic) Fetch(ctx context.Context, id string) (*Metadata, error) {
+	var resp itunesResponse
+	if err := getJSON(ctx, a.HTTPClient, a.APIURL+"/lookup?id="+url.QueryEscape(id)+"&entity=song", &resp); err != nil {
+		return nil, err
+	}
+	for _, r := range resp.Results {
+		if strconv.FormatInt(r.TrackID, 10) == id {
+			images := appleArtwork(func(size string) string {
+				return strings.Replace(r.ArtworkURL100, "100x100", size, 1)
+			})
+			return &Metadata{
+				Provider:   a.Name(),
+				Kind:       KindTrack,
+				ID:         id,
+				URL:        r.TrackViewURL,
+				Title:      r.TrackName,
+				Artist:     r.ArtistName,
+				Artists:    []string{r.ArtistName},
+				Album:      r.CollectionName,
+				AlbumCover: images[0].URL,
+				Images:     images,
+				DurationMs: r.TrackTimeMillis,
+				Explicit:   r.TrackExplicitness == "explicit",
+				PreviewURL: r.PreviewURL,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("track %s not found", id)
+}
+
+// appleArtwork builds the sizes we store from an artwork URL template
+func appleArtwork(sized func(size string) string) []Image {
+	var images []Image
+	for _, px := range []int{640, 300, 64} {
+		images = append(images, Image{URL: sized(fmt.Sprintf("%dx%d", px, px)), Width: px, Height: px})
+	}
+	return images
+}
+
+type appleCatalogResponse struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes struct {
+			Name             string `json:"name"`
+			ArtistName       string `json:"artistName"`
+			AlbumName        string `json:"albumName"`
+			URL              string `json:"url"`
+			ISRC             string `json:"isrc"`
+			DurationInMillis int    `json:"durationInMillis"`
+			ContentRating    string `json:"contentRating"`
+			Previews         []struct {
+				URL string `json:"url"`
+			} `json:"previews"`
+			Artwork struct {
+				URL string `json:"url"`
+			} `json:"artwork"`
+		} `json:"attributes"`
+	} `json:"data"`
+}
+
+func (a *AppleMusic) SearchISRC(ctx context.Context, isrc string) (*Metadata, error) {
+	if a.DeveloperToken == "" {
+		return nil, ErrNotConfigured
+	}
+
+	endpoint := fmt.Sprintf("%s/catalog/%s/songs?filter[isrc]=%s", a.CatalogURL, url.PathEscape(a.Storefront), url.QueryEscape(isrc))
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.DeveloperToken)
+
+	var resp appleCatalogResponse
+	if err := doJSON(a.HTTPClient, req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) == 0 {
+		return nil, fmt.Errorf("no Apple Music song for ISRC %s", isrc)
+	}
+
+	song := resp.Data[0]
+	images := appleArtwork(func(size string) string {
+		return strings.Replace(song.Attributes.Artwork.URL, "{w}x{h}", size, 1)
+	})
+	meta := &Metadata{
+		Provider:   a.Name(),
+		Kind:       KindTrack,
+		ID:         song.ID,
+		URL:        song.Attributes.URL,
+		Title:      song.Attributes.Name,
+		Artist:     song.Attributes.ArtistName,
+		Artists:    []string{song.Attributes.ArtistName},
+		Album:      song.Attributes.AlbumName,
+		AlbumCover: images[0].URL,
+		Images:     images,
+		DurationMs: song.Attributes.DurationInMillis,
+		Explicit:   song.Attributes.ContentRating == "explicit",
+		ISRC:       song.Attributes.ISRC,
+	}
+	if len(song.Attributes.Previews) > 0 {
+		meta.PreviewURL = song.Attributes.Previews[0].URL
+	}
+	return meta, nil
+}
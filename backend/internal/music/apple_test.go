@@ -0,0 +1,131 @@
+package music
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAppleMusicMatch(t *testing.T) {
+	a := NewAppleMusic()
+	tests := []struct {
+		url    string
+		wantID string
+		wantOK bool
+	}{
+		{"https://music.apple.com/us/song/one-more-time/697195462", "697195462", true},
+		{"https://music.apple.com/gb/album/discovery/697194953?i=697195462", "697195462", true},
+		{"https://music.apple.com/us/album/discovery/697194953", "", false},
+		{"https://music.apple.com/us/song/one-more-time/abc", "", false},
+		{"https://music.apple.com/us/album/discovery/697194953?i=abc", "", false},
+		{"https://itunes.apple.com/us/song/one-more-time/697195462", "", false},
+	}
+	for _, tt := range tests {
+		id, ok := a.Match(tt.url)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("Match(%q) = %q, %v; want %q, %v", tt.url, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func newFakeAppleMusic(t *testing.T) *AppleMusic {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/lookup", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "697195462" {
+			w.Write([]byte(`{"resultCount": 0, "results": []}`))
+			return
+		}
+		// album lookups include the collection itself before its songs
+		w.Write([]byte(`{"resultCount": 2, "results": [
+			{"collectionName": "Discovery"},
+			{"trackId": 697195462, "trackName": "One More Time", "artistName": "Daft Punk", "collectionName": "Discovery",
+			 "trackViewUrl": "https://music.apple.com/us/song/one-more-time/697195462",
+			 "artworkUrl100": "https://img.example/art/100x100bb.jpg", "trackTimeMillis": 320357,
+			 "trackExplicitness": "notExplicit", "previewUrl": "https://audio.example/preview.m4a"}
+		]}`))
+	})
+	mux.HandleFunc("/catalog/us/songs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer dev-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("filter[isrc]") != "GBDUW0000053" {
+			w.Write([]byte(`{"data": []}`))
+			return
+		}
+		w.Write([]byte(`{"data": [{"id": "697195462", "attributes": {
+			"name": "One More Time", "artistName": "Daft Punk", "albumName": "Discovery",
+			"url": "https://music.apple.com/us/song/one-more-time/697195462", "isrc": "GBDUW0000053",
+			"durationInMillis": 320357, "contentRating": "explicit",
+			"previews": [{"url": "https://audio.example/preview.m4a"}],
+			"artwork": {"url": "https://img.example/art/{w}x{h}bb.jpg"}
+		}}]}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	a := NewAppleMusic()
+	a.APIURL = server.URL
+	a.CatalogURL = server.URL
+	a.Storefront = "us"
+	a.DeveloperToken = ""
+	a.HTTPClient = server.Client()
+	return a
+}
+
+func TestAppleMusicFetch(t *testing.T) {
+	a := newFakeAppleMusic(t)
+
+	meta, err := a.Fetch(context.Background(), "697195462")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	want := &Metadata{
+		Provider:   "apple_music",
+		Kind:       KindTrack,
+		ID:         "697195462",
+		URL:        "https://music.apple.com/us/song/one-more-time/697195462",
+		Title:      "One More Time",
+		Artist:     "Daft Punk",
+		Artists:    []string{"Daft Punk"},
+		Album:      "Discovery",
+		AlbumCover: "https://img.example/art/640x640bb.jpg",
+		Images: []Image{
+			{URL: "https://img.example/art/640x640bb.jpg", Width: 640, Height: 640},
+			{URL: "https://img.example/art/300x300bb.jpg", Width: 300, Height: 300},
+			{URL: "https://img.example/art/64x64bb.jpg", Width: 64, Height: 64},
+		},
+		DurationMs: 320357,
+		PreviewURL: "https://audio.example/preview.m4a",
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("Fetch = %+v\nwant %+v", meta, want)
+	}
+
+	if _, err := a.Fetch(context.Background(), "1"); err == nil {
+		t.Error("Fetch of a missing track succeeded")
+	}
+}
+
+func TestAppleMusicSearchISRC(t *testing.T) {
+	a := newFakeAppleMusic(t)
+
+	if _, err := a.SearchISRC(context.Background(), "GBDUW0000053"); err != ErrNotConfigured {
+		t.Fatalf("SearchISRC without a developer token = %v, want ErrNotConfigured", err)
+	}
+
+	a.DeveloperToken = "dev-token"
+	meta, err := a.SearchISRC(context.Background(), "GBDUW0000053")
+	if err != nil {
+		t.Fatalf("SearchISRC: %v", err)
+	}
+	if meta.ID != "697195462" || !meta.Explicit || meta.ISRC != "GBDUW0000053" || meta.AlbumCover != "https://img.example/art/640x640bb.jpg" {
+		t.Errorf("SearchISRC = %+v", meta)
+	}
+
+	if _, err := a.SearchISRC(context.Background(), "USXXX0000000"); err == nil {
+		t.Error("SearchISRC of an unknown ISRC succeeded")
+	}
+}
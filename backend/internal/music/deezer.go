@@ -0,0 +1,136 @@
+package music
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const DefaultDeezerAPIURL = "https://api.deezer.com"
+
+// Deezer uses the public API, which needs no credentials for track lookups
+type Deezer struct {
+	APIURL     string
+	HTTPClient *http.Client
+}
+
+func NewDeezer() *Deezer {
+	return &Deezer{APIURL: DefaultDeezerAPIURL, HTTPClient: defaultHTTPClient}
+}
+
+func (d *Deezer) Name() string {
+	return "deezer"
+}
+
+// Match handles deezer.com/track/ID and localised deezer.com/fr/track/ID links
+func (d *Deezer) Match(rawURL string) (string, bool) {
+	u, ok := parseHostURL(rawURL, "deezer.com")
+	if !ok {
+		return "", false
+	}
+	segments := pathSegments(u)
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "track" {
+			if _, err := strconv.ParseUint(segments[i+1], 10, 64); err == nil {
+				return segments[i+1], true
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
+
+type deezerTrack struct {
+	ID             int64  `json:"id"`
+	Title          string `json:"title"`
+	Link           string `json:"link"`
+	ISRC           string `json:"isrc"`
+	Duration       int    `json:"duration"`
+	ExplicitLyrics bool   `json:"explicit_lyrics"`
+	Preview        string `json:"preview"`
+	Artist         struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	Contributors []struct {
+		Name string `json:"name"`
+	} `json:"contributors"`
+	Album struct {
+		Title       string `json:"title"`
+		CoverSmall  string `json:"cover_small"`
+		CoverMedium string `json:"cover_medium"`
+		CoverBig    string `json:"cover_big"`
+		CoverXL     string `json:"cover_xl"`
+	} `json:"album"`
+	// deezer reports errors with a 200 status and this object
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (d *Deezer) fetchTrack(ctx context.Context, path string) (*deezerTrack, error) {
+	var track deezerTrack
+	if err := getJSON(ctx, d.HTTPClient, d.APIURL+path, &track); err != nil {
+		return nil, err
+	}
+	if track.Error != nil {
+		return nil, fmt.Errorf("Deezer API error: %s", track.Error.Message)
+	}
+	return &track, nil
+}
+
+func (d *Deezer) Fetch(ctx context.Context, id string) (*Metadata, error) {
+	track, err := d.fetchTrack(ctx, "/track/"+url.PathEscape(id))
+	if err != nil {
+		return nil, err
+	}
+	return d.metadata(track), nil
+}
+
+func (d *Deezer) SearchISRC(ctx context.Context, isrc string) (*Metadata, error) {
+	track, err := d.fetchTrack(ctx, "/track/isrc:"+url.PathEscape(isrc))
+	if err != nil {
+		return nil, err
+	}
+	return d.metadata(track), nil
+}
+
+func (d *Deezer) metadata(track *deezerTrack) *Metadata {
+	meta := &Metadata{
+		Provider:   d.Name(),
+		Kind:       KindTrack,
+		ID:         strconv.FormatInt(track.ID, 10),
+		URL:        track.Link,
+		Title:      track.Title,
+		Artist:     track.Artist.Name,
+		Album:      track.Album.Title,
+		DurationMs: track.Duration * 1000,
+		Explicit:   track.ExplicitLyrics,
+		PreviewURL: track.Preview,
+		ISRC:       track.ISRC,
+	}
+	for _, contributor := range track.Contributors {
+		meta.Artists = append(meta.Artists, contributor.Name)
+	}
+	if len(meta.Artists) == 0 && track.Artist.Name != "" {
+		meta.Artists = []string{track.Artist.Name}
+	}
+
+	// largest first, like spotify
+	for _, image := range []Image{
+		{URL: track.Album.CoverXL, Width: 1000, Height: 1000},
+		{URL: track.Album.CoverBig, Width: 500, Height: 500},
+		{URL: track.Album.CoverMedium, Width: 250, Height: 250},
+		{URL: track.Album.CoverSmall, Width: 56, Height: 56},
+	} {
+		if image.URL != "" {
+			meta.Images = append(meta.Images, image)
+		}
+	}
+	if len(meta.Images) > 0 {
+		meta.AlbumCover = meta.Images[0].URL
+	}
+	return meta
+}
@@ -0,0 +1,102 @@
+package music
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDeezerMatch(t *testing.T) {
+	d := NewDeezer()
+	tests := []struct {
+		url    string
+		wantID string
+		wantOK bool
+	}{
+		{"https://www.deezer.com/track/3135556", "3135556", true},
+		{"https://www.deezer.com/fr/track/3135556?utm_source=share", "3135556", true},
+		{"https://deezer.com/en/track/3135556", "3135556", true},
+		{"https://www.deezer.com/album/302127", "", false},
+		{"https://www.deezer.com/track/abc", "", false},
+		{"https://www.deezer.com.evil.example/track/3135556", "", false},
+		{"deezer.com/track/3135556", "", false},
+	}
+	for _, tt := range tests {
+		id, ok := d.Match(tt.url)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("Match(%q) = %q, %v; want %q, %v", tt.url, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func newFakeDeezer(t *testing.T) *Deezer {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/track/3135556", "/track/isrc:GBDUW0000059":
+			w.Write([]byte(`{
+				"id": 3135556, "title": "Harder, Better, Faster, Stronger", "link": "https://www.deezer.com/track/3135556",
+				"isrc": "GBDUW0000059", "duration": 224, "explicit_lyrics": false, "preview": "https://cdn.example/preview.mp3",
+				"artist": {"name": "Daft Punk"},
+				"contributors": [{"name": "Daft Punk"}],
+				"album": {"title": "Discovery", "cover_small": "https://img.example/56.jpg", "cover_xl": "https://img.example/1000.jpg"}
+			}`))
+		default:
+			// deezer reports missing tracks as a 200 with an error object
+			w.Write([]byte(`{"error": {"type": "DataException", "message": "no data", "code": 800}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	d := NewDeezer()
+	d.APIURL = server.URL
+	d.HTTPClient = server.Client()
+	return d
+}
+
+func TestDeezerFetch(t *testing.T) {
+	d := newFakeDeezer(t)
+
+	meta, err := d.Fetch(context.Background(), "3135556")
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	want := &Metadata{
+		Provider:   "deezer",
+		Kind:       KindTrack,
+		ID:         "3135556",
+		URL:        "https://www.deezer.com/track/3135556",
+		Title:      "Harder, Better, Faster, Stronger",
+		Artist:     "Daft Punk",
+		Artists:    []string{"Daft Punk"},
+		Album:      "Discovery",
+		AlbumCover: "https://img.example/1000.jpg",
+		Images: []Image{
+			{URL: "https://img.example/1000.jpg", Width: 1000, Height: 1000},
+			{URL: "https://img.example/56.jpg", Width: 56, Height: 56},
+		},
+		DurationMs: 224000,
+		PreviewURL: "https://cdn.example/preview.mp3",
+		ISRC:       "GBDUW0000059",
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("Fetch = %+v\nwant %+v", meta, want)
+	}
+
+	if _, err := d.Fetch(context.Background(), "1"); err == nil {
+		t.Error("Fetch of a missing track succeeded")
+	}
+}
+
+func TestDeezerSearchISRC(t *testing.T) {
+	d := newFakeDeezer(t)
+
+	meta, err := d.SearchISRC(context.Background(), "GBDUW0000059")
+	if err != nil {
+		t.Fatalf("SearchISRC: %v", err)
+	}
+	if meta.ID != "3135556" || meta.URL != "https://www.deezer.com/track/3135556" {
+		t.Errorf("SearchISRC = %+v", meta)
+	}
+}
@@ -0,0 +1,229 @@
+package music
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"good_morning_backend/internal/spotify"
+)
+
+var ErrUnsupportedURL = errors.New("no music provider recognises this URL")
+
+var ErrNotConfigured = errors.New("music provider is not configured")
+
+// KindTrack is the default kind, providers set others (album, playlist, episode...) where they support them
+const KindTrack = "track"
+
+type Image struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+type Metadata struct {
+	Provider   string
+	Kind       string
+	ID         string
+	URL        string
+	Title      string
+	Artist     string
+	Artists    []string
+	Album      string
+	AlbumCover string
+	Images     []Image
+	DurationMs int
+	Explicit   bool
+	PreviewURL string
+	ISRC       string
+}
+
+// Provider resolves song links for one streaming service
+type Provider interface {
+	Name() string
+	// Match reports whether the URL belongs to this provider, returning the provider's ID for the item
+	Match(rawURL string) (string, bool)
+	Fetch(ctx context.Context, id string) (*Metadata, error)
+}
+
+// ISRCSearcher is implemented by providers that can look a recording up by its ISRC,
+// which is how we find the same song on another service
+type ISRCSearcher interface {
+	SearchISRC(ctx context.Context, isrc string) (*Metadata, error)
+}
+
+type Registry struct {
+	mu        sync.RWMutex
+	providers []Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	return &Registry{providers: providers}
+}
+
+func (r *Registry) Register(p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers = append(r.providers, p)
+}
+
+func (r *Registry) Providers() []Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Provider(nil), r.providers...)
+}
+
+func (r *Registry) Get(name string) (Provider, bool) {
+	for _, p := range r.Providers() {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Match finds the first provider that recognises the URL
+func (r *Registry) Match(rawURL string) (Provider, string, bool) {
+	for _, p := range r.Providers() {
+		if id, ok := p.Match(rawURL); ok {
+			return p, id, true
+		}
+	}
+	return nil, "", false
+}
+
+func (r *Registry) Resolve(ctx context.Context, rawURL string) (*Metadata, error) {
+	p, id, ok := r.Match(rawURL)
+	if !ok {
+		return nil, ErrUnsupportedURL
+	}
+	meta, err := p.Fetch(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	return meta, nil
+}
+
+// Equivalents links the song on every other service that can find it by ISRC, keyed by provider name.
+// The song's own provider is included so callers get a complete map.
+func (r *Registry) Equivalents(ctx context.Context, song *Metadata) map[string]string {
+	links := map[string]string{}
+	if song.URL != "" {
+		links[song.Provider] = song.URL
+	}
+	if song.ISRC == "" {
+		return links
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, p := range r.Providers() {
+		searcher, ok := p.(ISRCSearcher)
+		if !ok || p.Name() == song.Provider {
+			continue
+		}
+		wg.Add(1)
+		go func(name string, searcher ISRCSearcher) {
+			defer wg.Done()
+			match, err := searcher.SearchISRC(ctx, song.ISRC)
+			if err != nil {
+				if !errors.Is(err, ErrNotConfigured) {
+					log.Printf("failed to find %s on %s: %v", song.ISRC, name, err)
+				}
+				return
+			}
+			if match.URL == "" {
+				return
+			}
+			mu.Lock()
+			links[name] = match.URL
+			mu.Unlock()
+		}(p.Name(), searcher)
+	}
+	wg.Wait()
+
+	return links
+}
+
+var (
+	defaultRegistry     *Registry
+	defaultRegistryOnce sync.Once
+)
+
+// DefaultRegistry holds every provider we support, pointed at the real services
+func DefaultRegistry() *Registry {
+	defaultRegistryOnce.Do(func() {
+		defaultRegistry = NewRegistry(
+			NewSpotify(spotify.DefaultClient()),
+			NewAppleMusic(),
+			NewDeezer(),
+			NewYouTubeMusic(),
+			NewSoundCloud(),
+		)
+	})
+	return defaultRegistry
+}
+
+var defaultHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func getJSON(ctx context.Context, client *http.Client, rawURL string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, out)
+}
+
+// parseHostURL parses a link and checks its host against the given domains (subdomains included)
+func parseHostURL(rawURL string, hosts ...string) (*url.URL, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// pathSegments splits a URL path, dropping empty segments
+func pathSegments(u *url.URL) []string {
+	var segments []string
+	for _, s := range strings.Split(u.Path, "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
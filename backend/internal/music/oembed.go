@@ -0,0 +1,109 @@
+package music
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultYouTubeOEmbedURL    = "https://www.youtube.com/oembed"
+	DefaultSoundCloudOEmbedURL = "https://soundcloud.com/oembed"
+)
+
+// OEmbed covers services that only expose metadata through oEmbed, where the item ID is its canonical URL
+type OEmbed struct {
+	name       string
+	match      func(rawURL string) (string, bool)
+	EmbedURL   string
+	HTTPClient *http.Client
+}
+
+func NewYouTubeMusic() *OEmbed {
+	return &OEmbed{
+		name:       "youtube_music",
+		match:      matchYouTube,
+		EmbedURL:   DefaultYouTubeOEmbedURL,
+		HTTPClient: defaultHTTPClient,
+	}
+}
+
+func NewSoundCloud() *OEmbed {
+	return &OEmbed{
+		name:       "soundcloud",
+		match:      matchSoundCloud,
+		EmbedURL:   DefaultSoundCloudOEmbedURL,
+		HTTPClient: defaultHTTPClient,
+	}
+}
+
+func (o *OEmbed) Name() string {
+	return o.name
+}
+
+func (o *OEmbed) Match(rawURL string) (string, bool) {
+	return o.match(rawURL)
+}
+
+type oembedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (o *OEmbed) Fetch(ctx context.Context, id string) (*Metadata, error) {
+	params := url.Values{}
+	params.Set("url", id)
+	params.Set("format", "json")
+
+	var resp oembedResponse
+	if err := getJSON(ctx, o.HTTPClient, o.EmbedURL+"?"+params.Encode(), &resp); err != nil {
+		return nil, err
+	}
+	meta := &Metadata{
+		Provider:   o.name,
+		Kind:       KindTrack,
+		ID:         id,
+		URL:        id,
+		Title:      resp.Title,
+		Artist:     resp.AuthorName,
+		AlbumCover: resp.ThumbnailURL,
+	}
+	if resp.AuthorName != "" {
+		meta.Artists = []string{resp.AuthorName}
+	}
+	return meta, nil
+}
+
+// matchYouTube accepts music.youtube.com, youtube.com and youtu.be video links, normalised to a watch URL
+func matchYouTube(rawURL string) (string, bool) {
+	u, ok := parseHostURL(rawURL, "youtube.com", "youtu.be")
+	if !ok {
+		return "", false
+	}
+
+	videoID := u.Query().Get("v")
+	if strings.EqualFold(u.Hostname(), "youtu.be") {
+		if segments := pathSegments(u); len(segments) == 1 {
+			videoID = segments[0]
+		}
+	}
+	if videoID == "" {
+		return "", false
+	}
+	return "https://music.youtube.com/watch?v=" + url.QueryEscape(videoID), true
+}
+
+// matchSoundCloud accepts soundcloud.com/{artist}/{track}, dropping tracking params
+func matchSoundCloud(rawURL string) (string, bool) {
+	u, ok := parseHostURL(rawURL, "soundcloud.com")
+	if !ok {
+		return "", false
+	}
+	segments := pathSegments(u)
+	if len(segments) != 2 || segments[1] == "sets" {
+		return "", false
+	}
+	return "https://soundcloud.com/" + segments[0] + "/" + segments[1], true
+}
@@ -0,0 +1,127 @@
+package music
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestYouTubeMusicMatch(t *testing.T) {
+	y := NewYouTubeMusic()
+	tests := []struct {
+		url    string
+		wantID string
+		wantOK bool
+	}{
+		{"https://music.youtube.com/watch?v=FGBhQbmPwH8&si=abc", "https://music.youtube.com/watch?v=FGBhQbmPwH8", true},
+		{"https://www.youtube.com/watch?v=FGBhQbmPwH8&t=30", "https://music.youtube.com/watch?v=FGBhQbmPwH8", true},
+		{"https://youtu.be/FGBhQbmPwH8?si=abc", "https://music.youtube.com/watch?v=FGBhQbmPwH8", true},
+		{"https://YOUTU.BE/FGBhQbmPwH8", "https://music.youtube.com/watch?v=FGBhQbmPwH8", true},
+		{"https://www.youtube.com/channel/UC123", "", false},
+		{"https://youtu.be/", "", false},
+		{"https://notyoutube.com/watch?v=FGBhQbmPwH8", "", false},
+	}
+	for _, tt := range tests {
+		id, ok := y.Match(tt.url)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("Match(%q) = %q, %v; want %q, %v", tt.url, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+func TestSoundCloudMatch(t *testing.T) {
+	s := NewSoundCloud()
+	tests := []struct {
+		url    string
+		wantID string
+		wantOK bool
+	}{
+		{"https://soundcloud.com/daftpunkofficial/one-more-time?utm_source=clipboard", "https://soundcloud.com/daftpunkofficial/one-more-time", true},
+		{"https://m.soundcloud.com/daftpunkofficial/one-more-time", "https://soundcloud.com/daftpunkofficial/one-more-time", true},
+		{"https://soundcloud.com/daftpunkofficial", "", false},
+		{"https://soundcloud.com/daftpunkofficial/sets", "", false},
+		{"https://soundcloud.com/daftpunkofficial/sets/discovery", "", false},
+	}
+	for _, tt := range tests {
+		id, ok := s.Match(tt.url)
+		if id != tt.wantID || ok != tt.wantOK {
+			t.Errorf("Match(%q) = %q, %v; want %q, %v", tt.url, id, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
+
+// newFakeOEmbed serves oEmbed responses for the given canonical URLs and 404s the rest, like the real endpoints
+func newFakeOEmbed(t *testing.T, responses map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "json" {
+			http.Error(w, "format must be json", http.StatusBadRequest)
+			return
+		}
+		body, ok := responses[r.URL.Query().Get("url")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOEmbedFetch(t *testing.T) {
+	server := newFakeOEmbed(t, map[string]string{
+		"https://music.youtube.com/watch?v=FGBhQbmPwH8":         `{"title": "Daft Punk - One More Time", "author_name": "Daft Punk", "thumbnail_url": "https://i.ytimg.example/hq.jpg"}`,
+		"https://soundcloud.com/daftpunkofficial/one-more-time": `{"title": "One More Time by Daft Punk", "author_name": "daftpunkofficial", "thumbnail_url": "https://i1.sndcdn.example/t500.jpg"}`,
+	})
+
+	tests := []struct {
+		provider *OEmbed
+		url      string
+		want     *Metadata
+	}{
+		{NewYouTubeMusic(), "https://youtu.be/FGBhQbmPwH8", &Metadata{
+			Provider:   "youtube_music",
+			Kind:       KindTrack,
+			ID:         "https://music.youtube.com/watch?v=FGBhQbmPwH8",
+			URL:        "https://music.youtube.com/watch?v=FGBhQbmPwH8",
+			Title:      "Daft Punk - One More Time",
+			Artist:     "Daft Punk",
+			Artists:    []string{"Daft Punk"},
+			AlbumCover: "https://i.ytimg.example/hq.jpg",
+		}},
+		{NewSoundCloud(), "https://soundcloud.com/daftpunkofficial/one-more-time?si=1", &Metadata{
+			Provider:   "soundcloud",
+			Kind:       KindTrack,
+			ID:         "https://soundcloud.com/daftpunkofficial/one-more-time",
+			URL:        "https://soundcloud.com/daftpunkofficial/one-more-time",
+			Title:      "One More Time by Daft Punk",
+			Artist:     "daftpunkofficial",
+			Artists:    []string{"daftpunkofficial"},
+			AlbumCover: "https://i1.sndcdn.example/t500.jpg",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider.Name(), func(t *testing.T) {
+			tt.provider.EmbedURL = server.URL
+			tt.provider.HTTPClient = server.Client()
+
+			id, ok := tt.provider.Match(tt.url)
+			if !ok {
+				t.Fatalf("Match(%q) failed", tt.url)
+			}
+			meta, err := tt.provider.Fetch(context.Background(), id)
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if !reflect.DeepEqual(meta, tt.want) {
+				t.Errorf("Fetch = %+v\nwant %+v", meta, tt.want)
+			}
+
+			if _, err := tt.provider.Fetch(context.Background(), "https://example.com/private"); err == nil {
+				t.Error("Fetch of an unknown item succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package music
+
+import (
+	"context"
+
+	"good_morning_backend/internal/spotify"
+)
+
+type Spotify struct {
+	Client *spotify.Client
+}
+
+func NewSpotify(client *spotify.Client) *Spotify {
+	return &Spotify{Client: client}
+}
+
+func (s *Spotify) Name() string {
+	return "spotify"
+}
+
+// Match returns short links as-is, they're resolved in Fetch; everything else becomes a spotify: URI
+func (s *Spotify) Match(rawURL string) (string, bool) {
+	if spotify.IsShortLink(rawURL) {
+		return rawURL, true
+	}
+	kind, id, err := spotify.ParseURL(rawURL)
+	if err != nil {
+		return "", false
+	}
+	return spotify.URI(kind, id), true
+}
+
+func (s *Spotify) Fetch(ctx context.Context, id string) (*Metadata, error) {
+	if spotify.IsShortLink(id) {
+		resolved, err := s.Client.ResolveShortLink(id)
+		if err != nil {
+			return nil, err
+		}
+		id = resolved
+	}
+
+	kind, itemID, err := spotify.ParseURL(id)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := s.Client.FetchDetails(ctx, kind, itemID)
+	if err != nil {
+		return nil, err
+	}
+	return s.metadata(details), nil
+}
+
+func (s *Spotify) SearchISRC(ctx context.Context, isrc string) (*Metadata, error) {
+	details, err := s.Client.SearchISRC(ctx, isrc)
+	if err != nil {
+		return nil, err
+	}
+	return s.metadata(details), nil
+}
+
+func (s *Spotify) metadata(details *spotify.TrackDetails) *Metadata {
+	meta := &Metadata{
+		Provider:   s.Name(),
+		Kind:       string(details.Kind),
+		ID:         details.ID,
+		URL:        details.URL,
+		Title:      details.Title,
+		Artist:     details.Artist,
+		Artists:    details.Artists,
+		Album:      details.AlbumName,
+		AlbumCover: details.AlbumCover,
+		DurationMs: details.DurationMs,
+		Explicit:   details.Explicit,
+		PreviewURL: details.PreviewURL,
+		ISRC:       details.ISRC,
+	}
+	for _, image := range details.Images {
+		meta.Images = append(meta.Images, Image{URL: image.URL, Width: image.Width, Height: image.Height})
+	}
+	return meta
+}
@@ -0,0 +1,118 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestMemoryStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = clock.Now
+	return s, clock
+}
+
+// take is Take for tests, where the memory store never errors
+func take(t *testing.T, s Store, key string, limit Limit) (bool, time.Duration) {
+	t.Helper()
+	allowed, wait, err := s.Take(context.Background(), key, limit)
+	if err != nil {
+		t.Fatalf("Take(%s): %v", key, err)
+	}
+	return allowed, wait
+}
+
+func TestMemoryStoreBurstAndRefill(t *testing.T) {
+	s, clock := newTestMemoryStore()
+	limit := Every(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := take(t, s, "a", limit); !allowed {
+			t.Fatalf("request %d of the burst was limited", i+1)
+		}
+	}
+	if allowed, wait := take(t, s, "a", limit); allowed || wait != 20*time.Second {
+		t.Fatalf("request past the burst = %v, wait %v; want limited for 20s", allowed, wait)
+	}
+
+	// half a token back isn't enough, and the wait shrinks
+	clock.Advance(10 * time.Second)
+	if allowed, wait := take(t, s, "a", limit); allowed || wait != 10*time.Second {
+		t.Errorf("after 10s = %v, wait %v; want limited for 10s", allowed, wait)
+	}
+	clock.Advance(10 * time.Second)
+	if allowed, _ := take(t, s, "a", limit); !allowed {
+		t.Error("a refilled token was refused")
+	}
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Error("only one token should have refilled")
+	}
+
+	// a long quiet spell refills the bucket up to the burst, not beyond
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if allowed, _ := take(t, s, "a", limit); !allowed {
+			t.Fatalf("request %d after an hour was limited", i+1)
+		}
+	}
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Error("bucket refilled past its burst")
+	}
+}
+
+func TestMemoryStoreKeysAreIsolated(t *testing.T) {
+	s, _ := newTestMemoryStore()
+	limit := Every(1, time.Hour)
+
+	if allowed, _ := take(t, s, "pair:ip:192.0.2.1", limit); !allowed {
+		t.Fatal("first request limited")
+	}
+	if allowed, _ := take(t, s, "pair:ip:192.0.2.1", limit); allowed {
+		t.Fatal("second request from the same IP allowed")
+	}
+	for _, key := range []string{"pair:ip:192.0.2.2", "pair:user:192.0.2.1", "notice:ip:192.0.2.1"} {
+		if allowed, _ := take(t, s, key, limit); !allowed {
+			t.Errorf("%s was limited by another key's bucket", key)
+		}
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s, clock := newTestMemoryStore()
+	limit := Every(2, time.Minute)
+
+	take(t, s, "full", limit)
+	take(t, s, "drained", Every(2, time.Hour))
+	take(t, s, "drained", Every(2, time.Hour))
+
+	// a minute later "full" is back to its burst and can go; "drained" still remembers being empty
+	clock.Advance(time.Minute)
+	take(t, s, "other", limit)
+	s.mu.Lock()
+	_, fullKept := s.buckets["full"]
+	_, drainedKept := s.buckets["drained"]
+	s.mu.Unlock()
+	if fullKept || !drainedKept {
+		t.Errorf("after sweep: full kept %v, drained kept %v; want false, true", fullKept, drainedKept)
+	}
+	if allowed, _ := take(t, s, "drained", Every(2, time.Hour)); allowed {
+		t.Error("sweeping forgot a drained bucket")
+	}
+}
+
+func TestMemoryStoreClockGoingBackwards(t *testing.T) {
+	s, clock := newTestMemoryStore()
+	limit := Every(1, time.Minute)
+
+	take(t, s, "a", limit)
+	clock.Advance(-time.Hour)
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Error("a clock step backwards refilled the bucket")
+	}
+}
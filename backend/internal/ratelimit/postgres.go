@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PostgresStore shares buckets between instances through the RateLimitBucket table. Each Take is
+// a single upsert, so concurrent requests on different instances can't both spend the last token
+type PostgresStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresStore(db *gorm.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+const takeSQL = `
+INSERT INTO "RateLimitBucket" (key, tokens, allowed, updated_at)
+VALUES (@key, @burst - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE SET
+	allowed = LEAST(@burst, "RateLimitBucket".tokens + EXTRACT(EPOCH FROM NOW() - "RateLimitBucket".updated_at) * @rate) >= 1,
+	tokens = LEAST(@burst, "RateLimitBucket".tokens + EXTRACT(EPOCH FROM NOW() - "RateLimitBucket".updated_at) * @rate)
+		- CASE WHEN LEAST(@burst, "RateLimitBucket".tokens + EXTRACT(EPOCH FROM NOW() - "RateLimitBucket".updated_at) * @rate) >= 1 THEN 1 ELSE 0 END,
+	updated_at = NOW()
+RETURNING tokens, allowed`
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	var result struct {
+		Tokens  float64
+		Allowed bool
+	}
+	err := s.db.WithContext(ctx).Raw(takeSQL, map[string]interface{}{
+		"key":   key,
+		"burst": float64(limit.Burst),
+		"rate":  limit.Rate,
+	}).Scan(&result).Error
+	if err != nil {
+		return false, 0, err
+	}
+
+	// now and then, clear out buckets nobody has touched in a day
+	if rand.Intn(1000) == 0 {
+		s.db.Exec(`DELETE FROM "RateLimitBucket" WHERE updated_at < NOW() - INTERVAL '1 day'`)
+	}
+
+	if !result.Allowed {
+		return false, retryAfter(result.Tokens, limit), nil
+	}
+	return true, 0, nil
+}
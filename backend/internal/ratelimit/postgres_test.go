@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"good_morning_backend/internal/dbtest"
+	"good_morning_backend/internal/models"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// the SQL is rendered without a database, so the named arguments are checked on every run
+func TestTakeSQLBindsArguments(t *testing.T) {
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		var result struct {
+			Tokens  float64
+			Allowed bool
+		}
+		return tx.Raw(takeSQL, map[string]interface{}{"key": "pair:ip:192.0.2.1", "burst": float64(5), "rate": 0.5}).Scan(&result)
+	})
+
+	for _, want := range []string{
+		`VALUES ('pair:ip:192.0.2.1', 5 - 1, TRUE, NOW())`,
+		`ON CONFLICT (key) DO UPDATE SET`,
+		`LEAST(5, "RateLimitBucket".tokens + EXTRACT(EPOCH FROM NOW() - "RateLimitBucket".updated_at) * 0.5) >= 1`,
+		`RETURNING tokens, allowed`,
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("SQL is missing %q:\n%s", want, sql)
+		}
+	}
+	if strings.Contains(sql, "@") {
+		t.Errorf("SQL has unbound arguments:\n%s", sql)
+	}
+}
+
+// rewind moves a bucket's last update into the past, standing in for time passing on the database clock
+func rewind(t *testing.T, db *gorm.DB, key string, d time.Duration) {
+	t.Helper()
+	if err := db.Exec(`UPDATE "RateLimitBucket" SET updated_at = updated_at - make_interval(secs => ?) WHERE key = ?`, d.Seconds(), key).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPostgresStore(t *testing.T) {
+	db := dbtest.Open(t, &models.RateLimitBucket{})
+	s := NewPostgresStore(db)
+	limit := Every(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if allowed, _ := take(t, s, "a", limit); !allowed {
+			t.Fatalf("request %d of the burst was limited", i+1)
+		}
+	}
+	allowed, wait := take(t, s, "a", limit)
+	if allowed || wait <= 19*time.Second || wait > 20*time.Second {
+		t.Fatalf("request past the burst = %v, wait %v; want limited for about 20s", allowed, wait)
+	}
+	if allowed, _ := take(t, s, "b", limit); !allowed {
+		t.Error("another key was limited by a's bucket")
+	}
+
+	rewind(t, db, "a", 20*time.Second)
+	if allowed, _ := take(t, s, "a", limit); !allowed {
+		t.Error("a refilled token was refused")
+	}
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Error("only one token should have refilled")
+	}
+
+	rewind(t, db, "a", time.Hour)
+	for i := 0; i < 3; i++ {
+		if allowed, _ := take(t, s, "a", limit); !allowed {
+			t.Fatalf("request %d after an hour was limited", i+1)
+		}
+	}
+	if allowed, _ := take(t, s, "a", limit); allowed {
+		t.Error("bucket refilled past its burst")
+	}
+}
+
+// instances racing for the last tokens can't overspend them, since each Take is one statement
+func TestPostgresStoreConcurrentTakes(t *testing.T) {
+	db := dbtest.Open(t, &models.RateLimitBucket{})
+	s := NewPostgresStore(db)
+	limit := Every(5, time.Hour)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowedCount := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, _, err := s.Take(context.Background(), "shared", limit)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if allowed {
+				mu.Lock()
+				allowedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowedCount != 5 {
+		t.Errorf("%d of 20 concurrent requests allowed, want 5", allowedCount)
+	}
+}
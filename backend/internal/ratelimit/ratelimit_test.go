@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"5/10m", Every(5, 10*time.Minute), false},
+		{" 30/1m ", Limit{Rate: 0.5, Burst: 30}, false},
+		{"1/1h", Limit{Rate: 1.0 / 3600, Burst: 1}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"0/1m", Limit{Burst: 0}, false},
+		{"5", Limit{}, true},
+		{"five/1m", Limit{}, true},
+		{"-1/1m", Limit{}, true},
+		{"5/soon", Limit{}, true},
+		{"5/0s", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLimit(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	if l, _ := ParseLimit("off"); l.Enabled() {
+		t.Error("off is enabled")
+	}
+	if l, _ := ParseLimit("0/1m"); l.Enabled() {
+		t.Error("0/1m is enabled")
+	}
+}
+
+func TestRefill(t *testing.T) {
+	limit := Every(3, time.Minute) // a token every 20s
+	tests := []struct {
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{0, 0, 0},
+		{0, 20 * time.Second, 1},
+		{0, 30 * time.Second, 1.5},
+		{1, time.Hour, 3}, // never past the burst
+		{2, -time.Minute, 2},
+	}
+	for _, tt := range tests {
+		if got := refill(tt.tokens, tt.elapsed, limit); got != tt.want {
+			t.Errorf("refill(%v, %v) = %v, want %v", tt.tokens, tt.elapsed, got, tt.want)
+		}
+	}
+
+	for tokens, want := range map[float64]time.Duration{0: 20 * time.Second, 0.5: 10 * time.Second, 1: 0, 2.5: 0} {
+		if got := retryAfter(tokens, limit); got != want {
+			t.Errorf("retryAfter(%v) = %v, want %v", tokens, got, want)
+		}
+	}
+}
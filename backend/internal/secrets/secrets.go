@@ -0,0 +1,74 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	aead     cipher.AEAD
+	aeadErr  error
+	aeadOnce sync.Once
+)
+
+// loadKey reads TOKEN_ENCRYPTION_KEY, a base64-encoded 32 byte AES-256 key
+func loadKey() (cipher.AEAD, error) {
+	aeadOnce.Do(func() {
+		encoded := os.Getenv("TOKEN_ENCRYPTION_KEY")
+		if encoded == "" {
+			aeadErr = errors.New("TOKEN_ENCRYPTION_KEY not set")
+			return
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			aeadErr = errors.New("TOKEN_ENCRYPTION_KEY must be 32 bytes, base64 encoded")
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			aeadErr = err
+			return
+		}
+		aead, aeadErr = cipher.NewGCM(block)
+	})
+	return aead, aeadErr
+}
+
+// Seal encrypts a secret for storage at rest, returning base64(nonce || ciphertext)
+func Seal(plaintext string) (string, error) {
+	gcm, err := loadKey()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func Open(sealed string) (string, error) {
+	gcm, err := loadKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("malformed sealed secret: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("malformed sealed secret")
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
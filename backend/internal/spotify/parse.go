@@ -0,0 +1,188 @@
+package spotify
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrInvalidURL = errors.New("invalid Spotify URL")
+	ErrInvalidID  = errors.New("invalid Spotify ID")
+)
+
+// spotify IDs are 22 base62 characters
+const idLength = 22
+
+func IsValidID(id string) bool {
+	if len(id) != idLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+type Kind string
+
+const (
+	KindTrack    Kind = "track"
+	KindAlbum    Kind = "album"
+	KindPlaylist Kind = "playlist"
+	KindEpisode  Kind = "episode"
+	KindShow     Kind = "show"
+)
+
+func (k Kind) valid() bool {
+	switch k {
+	case KindTrack, KindAlbum, KindPlaylist, KindEpisode, KindShow:
+		return true
+	}
+	return false
+}
+
+// URI formats a kind and ID as a spotify: URI, which ParseURL accepts back
+func URI(kind Kind, id string) string {
+	return "spotify:" + string(kind) + ":" + id
+}
+
+// ParseURL extracts the kind and ID from spotify: URIs and open.spotify.com links,
+// including localised (/intl-de/) and embed paths. Short links must go through ResolveShortLink first.
+func ParseURL(rawURL string) (Kind, string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+
+	if strings.HasPrefix(rawURL, "spotify:") {
+		parts := strings.Split(rawURL, ":")
+		// legacy playlist URIs look like spotify:user:{owner}:playlist:{id}
+		if len(parts) == 5 && parts[1] == "user" {
+			parts = []string{parts[0], parts[3], parts[4]}
+		}
+		if len(parts) != 3 || !Kind(parts[1]).valid() {
+			return "", "", ErrInvalidURL
+		}
+		id, err := validID(parts[2])
+		if err != nil {
+			return "", "", err
+		}
+		return Kind(parts[1]), id, nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", ErrInvalidURL
+	}
+	// links pasted without a scheme parse as a bare path
+	if u.Scheme == "" && u.Host == "" {
+		if u, err = url.Parse("https://" + rawURL); err != nil {
+			return "", "", ErrInvalidURL
+		}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", "", ErrInvalidURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host != "open.spotify.com" && host != "play.spotify.com" {
+		return "", "", ErrInvalidURL
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) > 0 && strings.HasPrefix(segments[0], "intl-") {
+		segments = segments[1:]
+	}
+	if len(segments) > 0 && segments[0] == "embed" {
+		segments = segments[1:]
+	}
+	// same legacy form as the URI, /user/{owner}/playlist/{id}
+	if len(segments) == 4 && segments[0] == "user" {
+		segments = segments[2:]
+	}
+	if len(segments) != 2 || !Kind(segments[0]).valid() {
+		return "", "", ErrInvalidURL
+	}
+
+	id, err := validID(segments[1])
+	if err != nil {
+		return "", "", err
+	}
+	return Kind(segments[0]), id, nil
+}
+
+func ParseTrackID(songURL string) (string, error) {
+	kind, id, err := ParseURL(songURL)
+	if err != nil {
+		return "", err
+	}
+	if kind != KindTrack {
+		return "", ErrInvalidURL
+	}
+	return id, nil
+}
+
+func validID(id string) (string, error) {
+	if !IsValidID(id) {
+		return "", ErrInvalidID
+	}
+	return id, nil
+}
+
+// IsShortLink reports whether the URL is a spotify.link (or older app.link) share link that needs resolving
+func IsShortLink(rawURL string) bool {
+	_, ok := parseShortLink(rawURL)
+	return ok
+}
+
+// parseShortLink accepts short links with or without a scheme, as ParseURL does for full links
+func parseShortLink(rawURL string) (*url.URL, bool) {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false
+	}
+	if u.Scheme == "" && u.Host == "" {
+		if u, err = url.Parse("https://" + rawURL); err != nil {
+			return nil, false
+		}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, false
+	}
+	host := strings.ToLower(u.Hostname())
+	return u, host == "spotify.link" || host == "spotify.app.link"
+}
+
+// ResolveShortLink follows a short link's redirects until it reaches an open.spotify.com URL
+func (c *Client) ResolveShortLink(rawURL string) (string, error) {
+	u, ok := parseShortLink(rawURL)
+	if !ok {
+		return "", ErrInvalidURL
+	}
+
+	var resolved string
+	client := *c.HTTPClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if strings.EqualFold(req.URL.Hostname(), "open.spotify.com") {
+			resolved = req.URL.String()
+			return http.ErrUseLastResponse
+		}
+		if len(via) >= 10 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resolved == "" {
+		return "", ErrInvalidURL
+	}
+	return resolved, nil
+}
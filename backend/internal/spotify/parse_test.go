@@ -0,0 +1,176 @@
+package spotify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const testID = "4uLU6hMCjMI75M1A2tKUQC"
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		wantKind Kind
+		wantID   string
+		wantErr  error
+	}{
+		{"track link", "https://open.spotify.com/track/" + testID, KindTrack, testID, nil},
+		{"si suffix", "https://open.spotify.com/track/" + testID + "?si=a1b2c3d4e5f6", KindTrack, testID, nil},
+		{"fragment", "https://open.spotify.com/album/" + testID + "#tracks", KindAlbum, testID, nil},
+		{"trailing slash", "https://open.spotify.com/playlist/" + testID + "/", KindPlaylist, testID, nil},
+		{"surrounding space", "  https://open.spotify.com/track/" + testID + "\n", KindTrack, testID, nil},
+		{"no scheme", "open.spotify.com/episode/" + testID, KindEpisode, testID, nil},
+		{"play host", "https://play.spotify.com/show/" + testID, KindShow, testID, nil},
+		{"uppercase host", "https://OPEN.SPOTIFY.COM/track/" + testID, KindTrack, testID, nil},
+		{"intl path", "https://open.spotify.com/intl-de/track/" + testID, KindTrack, testID, nil},
+		{"intl path with si", "https://open.spotify.com/intl-pt/album/" + testID + "?si=xyz", KindAlbum, testID, nil},
+		{"embed path", "https://open.spotify.com/embed/track/" + testID, KindTrack, testID, nil},
+		{"intl embed path", "https://open.spotify.com/intl-fr/embed/episode/" + testID + "?utm_source=generator", KindEpisode, testID, nil},
+		{"legacy user playlist", "https://open.spotify.com/user/spotify/playlist/" + testID, KindPlaylist, testID, nil},
+		{"uri", "spotify:track:" + testID, KindTrack, testID, nil},
+		{"show uri", "spotify:show:" + testID, KindShow, testID, nil},
+		{"legacy playlist uri", "spotify:user:spotify:playlist:" + testID, KindPlaylist, testID, nil},
+
+		{"uri unknown kind", "spotify:artist:" + testID, "", "", ErrInvalidURL},
+		{"uri missing id", "spotify:track", "", "", ErrInvalidURL},
+		{"uri bad id", "spotify:track:not-an-id", "", "", ErrInvalidID},
+		{"short id", "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQ", "", "", ErrInvalidID},
+		{"long id", "https://open.spotify.com/track/" + testID + "X", "", "", ErrInvalidID},
+		{"non base62 id", "https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKU-C", "", "", ErrInvalidID},
+		{"artist link", "https://open.spotify.com/artist/" + testID, "", "", ErrInvalidURL},
+		{"wrong host", "https://open.spotify.com.example/track/" + testID, "", "", ErrInvalidURL},
+		{"wrong scheme", "ftp://open.spotify.com/track/" + testID, "", "", ErrInvalidURL},
+		{"extra segment", "https://open.spotify.com/track/" + testID + "/extra", "", "", ErrInvalidURL},
+		{"short link", "https://spotify.link/AbCdEf", "", "", ErrInvalidURL},
+		{"empty", "", "", "", ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, id, err := ParseURL(tt.url)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseURL(%q) error = %v, want %v", tt.url, err, tt.wantErr)
+			}
+			if kind != tt.wantKind || id != tt.wantID {
+				t.Errorf("ParseURL(%q) = %q, %q; want %q, %q", tt.url, kind, id, tt.wantKind, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestURIRoundTrip(t *testing.T) {
+	for _, kind := range []Kind{KindTrack, KindAlbum, KindPlaylist, KindEpisode, KindShow} {
+		gotKind, gotID, err := ParseURL(URI(kind, testID))
+		if err != nil || gotKind != kind || gotID != testID {
+			t.Errorf("ParseURL(URI(%s)) = %q, %q, %v", kind, gotKind, gotID, err)
+		}
+	}
+}
+
+func TestIsShortLink(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://spotify.link/AbCdEf", true},
+		{"http://spotify.link/AbCdEf", true},
+		{"spotify.link/AbCdEf", true},
+		{" spotify.link/AbCdEf ", true},
+		{"https://spotify.app.link/AbCdEf?_p=c", true},
+		{"spotify.app.link/AbCdEf", true},
+		{"https://SPOTIFY.LINK/AbCdEf", true},
+		{"https://open.spotify.com/track/" + testID, false},
+		{"https://notspotify.link/AbCdEf", false},
+		{"ftp://spotify.link/AbCdEf", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsShortLink(tt.url); got != tt.want {
+			t.Errorf("IsShortLink(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
+
+// redirectTransport sends every request to the test server, whatever host it was addressed to
+type redirectTransport struct {
+	target *url.URL
+	hosts  []string
+}
+
+func (rt *redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.hosts = append(rt.hosts, req.URL.Host)
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestResolveShortLink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/AbCdEf":
+			// spotify.link hands off to the branch.io domain before landing on open.spotify.com
+			http.Redirect(w, r, "https://spotify.app.link/landing?_p=c11", http.StatusFound)
+		case "/dead":
+			http.NotFound(w, r)
+		case "/loop":
+			http.Redirect(w, r, "https://spotify.link/loop", http.StatusFound)
+		default:
+			http.Redirect(w, r, "https://open.spotify.com/track/"+testID+"?si=abc", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+
+	newClient := func() (*Client, *redirectTransport) {
+		transport := &redirectTransport{target: target}
+		client := NewClient("id", "secret")
+		client.HTTPClient = &http.Client{Transport: transport}
+		return client, transport
+	}
+
+	t.Run("follows redirects", func(t *testing.T) {
+		client, transport := newClient()
+		resolved, err := client.ResolveShortLink("spotify.link/AbCdEf")
+		if err != nil {
+			t.Fatalf("ResolveShortLink: %v", err)
+		}
+		if want := "https://open.spotify.com/track/" + testID + "?si=abc"; resolved != want {
+			t.Errorf("ResolveShortLink = %q, want %q", resolved, want)
+		}
+		// open.spotify.com itself is never fetched
+		if len(transport.hosts) != 2 || transport.hosts[0] != "spotify.link" || transport.hosts[1] != "spotify.app.link" {
+			t.Errorf("requested hosts = %v", transport.hosts)
+		}
+		if kind, id, err := ParseURL(resolved); err != nil || kind != KindTrack || id != testID {
+			t.Errorf("resolved link doesn't parse: %q, %q, %v", kind, id, err)
+		}
+	})
+
+	t.Run("dead link", func(t *testing.T) {
+		client, _ := newClient()
+		if _, err := client.ResolveShortLink("https://spotify.link/dead"); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("ResolveShortLink = %v, want ErrInvalidURL", err)
+		}
+	})
+
+	t.Run("redirect loop", func(t *testing.T) {
+		client, _ := newClient()
+		if _, err := client.ResolveShortLink("https://spotify.link/loop"); err == nil {
+			t.Error("ResolveShortLink followed a redirect loop")
+		}
+	})
+
+	t.Run("not a short link", func(t *testing.T) {
+		client, transport := newClient()
+		if _, err := client.ResolveShortLink("https://example.com/AbCdEf"); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("ResolveShortLink = %v, want ErrInvalidURL", err)
+		}
+		if len(transport.hosts) != 0 {
+			t.Errorf("requested %v for a link that isn't a short link", transport.hosts)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package spotify
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -9,125 +10,444 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	DefaultAccountsURL = "https://accounts.spotify.com"
+	DefaultAPIURL      = "https://api.spotify.com/v1"
+
+	// refresh a little early so a token never expires mid-request
+	tokenExpiryMargin = time.Minute
 )
 
 type SpotifyTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
 }
 
 type SpotifyTrackResponse struct {
+	ID      string `json:"id"`
 	Name    string `json:"name"`
 	Artists []struct {
 		Name string `json:"name"`
 	} `json:"artists"`
 	Album struct {
-		Images []struct {
-			URL string `json:"url"`
-		} `json:"images"`
+		Name   string         `json:"name"`
+		Images []SpotifyImage `json:"images"`
 	} `json:"album"`
+	DurationMs  int     `json:"duration_ms"`
+	Explicit    bool    `json:"explicit"`
+	PreviewURL  *string `json:"preview_url"`
+	ExternalIDs struct {
+		ISRC string `json:"isrc"`
+	} `json:"external_ids"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
+}
+
+type SpotifyImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type SpotifyAlbumResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Artists []struct {
+		Name string `json:"name"`
+	} `json:"artists"`
+	Images       []SpotifyImage `json:"images"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
+}
+
+type SpotifyPlaylistResponse struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Owner struct {
+		DisplayName string `json:"display_name"`
+	} `json:"owner"`
+	Images       []SpotifyImage `json:"images"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
 }
 
+type SpotifyShowResponse struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Publisher    string         `json:"publisher"`
+	Images       []SpotifyImage `json:"images"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
+}
+
+type SpotifyEpisodeResponse struct {
+	ID              string              `json:"id"`
+	Name            string              `json:"name"`
+	DurationMs      int                 `json:"duration_ms"`
+	Explicit        bool                `json:"explicit"`
+	AudioPreviewURL *string             `json:"audio_preview_url"`
+	Images          []SpotifyImage      `json:"images"`
+	Show            SpotifyShowResponse `json:"show"`
+	ExternalURLs    struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
+}
+
+type SpotifySearchResponse struct {
+	Tracks struct {
+		Items []SpotifyTrackResponse `json:"items"`
+	} `json:"tracks"`
+}
+
+// TrackDetails describes any shareable item; for non-tracks Artist holds the album artist,
+// playlist owner or podcast publisher
 type TrackDetails struct {
+	Kind       Kind
+	ID         string
 	Title      string
 	Artist     string
+	Artists    []string
+	AlbumName  string
 	AlbumCover string
+	Images     []SpotifyImage
+	DurationMs int
+	Explicit   bool
+	PreviewURL string
+	ISRC       string
+	URL        string
+}
+
+// Client talks to the Spotify Web API with client credentials, caching the access token until shortly before it expires
+type Client struct {
+	ClientID     string
+	ClientSecret string
+	AccountsURL  string
+	APIURL       string
+	Market       string
+	HTTPClient   *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	refresh   singleflight.Group
+	now       func() time.Time
+}
+
+func NewClient(clientID, clientSecret string) *Client {
+	return &Client{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		AccountsURL:  DefaultAccountsURL,
+		APIURL:       DefaultAPIURL,
+		Market:       "US",
+		HTTPClient:   &http.Client{Timeout: 10 * time.Second},
+		now:          time.Now,
+	}
+}
+
+var (
+	defaultClient     *Client
+	defaultClientOnce sync.Once
+)
+
+// DefaultClient is configured from SPOTIFY_CLIENT_ID and SPOTIFY_CLIENT_SECRET on first use
+func DefaultClient() *Client {
+	defaultClientOnce.Do(func() {
+		defaultClient = NewClient(os.Getenv("SPOTIFY_CLIENT_ID"), os.Getenv("SPOTIFY_CLIENT_SECRET"))
+		if market := os.Getenv("SPOTIFY_MARKET"); market != "" {
+			defaultClient.Market = market
+		}
+	})
+	return defaultClient
 }
 
 func GetAccessToken() (string, error) {
-	clientID := os.Getenv("SPOTIFY_CLIENT_ID")
-	clientSecret := os.Getenv("SPOTIFY_CLIENT_SECRET")
-	if clientID == "" || clientSecret == "" {
-		return "", fmt.Errorf("SPOTIFY_CLIENT_ID or SPOTIFY_CLIENT_SECRET not set")
+	return DefaultClient().AccessToken()
+}
+
+func FetchTrackDetails(ctx context.Context, trackID string) (*TrackDetails, error) {
+	return DefaultClient().FetchTrackDetails(ctx, trackID)
+}
+
+func (c *Client) cachedToken() (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && c.now().Before(c.expiresAt) {
+		return c.token, true
+	}
+	return "", false
+}
+
+// AccessToken returns the cached token, or fetches a new one; concurrent callers share a single refresh
+func (c *Client) AccessToken() (string, error) {
+	if token, ok := c.cachedToken(); ok {
+		return token, nil
+	}
+
+	token, err, _ := c.refresh.Do("token", func() (interface{}, error) {
+		// another caller may have refreshed while we were waiting
+		if token, ok := c.cachedToken(); ok {
+			return token, nil
+		}
+
+		tokenResp, err := c.requestToken()
+		if err != nil {
+			return "", err
+		}
+
+		c.mu.Lock()
+		c.token = tokenResp.AccessToken
+		c.expiresAt = c.now().Add(tokenLifetime(tokenResp.ExpiresIn))
+		c.mu.Unlock()
+
+		return tokenResp.AccessToken, nil
+	})
+	if err != nil {
+		return "", err
 	}
+	return token.(string), nil
+}
 
-	auth := base64.StdEncoding.EncodeToString([]byte(clientID + ":" + clientSecret))
+// tokenLifetime is how long to keep a token for, refreshing tokenExpiryMargin early. A token that lives
+// less than twice the margin is kept for half its life instead, so it isn't refetched on every call
+func tokenLifetime(expiresIn int) time.Duration {
+	lifetime := time.Duration(expiresIn) * time.Second
+	if lifetime < 2*tokenExpiryMargin {
+		return lifetime / 2
+	}
+	return lifetime - tokenExpiryMargin
+}
 
+func (c *Client) requestToken() (*SpotifyTokenResponse, error) {
 	data := url.Values{}
 	data.Set("grant_type", "client_credentials")
+	return c.postToken(data)
+}
 
-	req, err := http.NewRequest("POST", "https://accounts.spotify.com/api/token", strings.NewReader(data.Encode()))
+// postToken calls the accounts token endpoint, shared by client-credentials and user authorization grants
+func (c *Client) postToken(data url.Values) (*SpotifyTokenResponse, error) {
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return nil, fmt.Errorf("SPOTIFY_CLIENT_ID or SPOTIFY_CLIENT_SECRET not set")
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(c.ClientID + ":" + c.ClientSecret))
+
+	req, err := http.NewRequest("POST", c.AccountsURL+"/api/token", strings.NewReader(data.Encode()))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Authorization", "Basic "+auth)
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Spotify token error: %s", resp.Status)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	var tokenResp SpotifyTokenResponse
 	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", err
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("Spotify token response missing access_token")
 	}
 
-	return tokenResp.AccessToken, nil
+	return &tokenResp, nil
 }
 
-func FetchTrackDetails(trackID string) (*TrackDetails, error) {
-	token, err := GetAccessToken()
+func (c *Client) get(ctx context.Context, path string, out interface{}) error {
+	token, err := c.AccessToken()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("https://api.spotify.com/v1/tracks/%s", trackID), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.APIURL+path, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Spotify API error: %s", resp.Status)
+		return fmt.Errorf("Spotify API error: %s", resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
+	return json.Unmarshal(body, out)
+}
+
+// FetchDetails looks up a track, album, playlist, episode or show
+func (c *Client) FetchDetails(ctx context.Context, kind Kind, id string) (*TrackDetails, error) {
+	// shows and episodes are region-locked and client-credential tokens have no user market
+	market := url.Values{"market": {c.Market}}.Encode()
+
+	switch kind {
+	case KindTrack:
+		return c.FetchTrackDetails(ctx, id)
+	case KindAlbum:
+		var albumResp SpotifyAlbumResponse
+		if err := c.get(ctx, "/albums/"+url.PathEscape(id), &albumResp); err != nil {
+			return nil, err
+		}
+		details := &TrackDetails{
+			Kind:       kind,
+			ID:         albumResp.ID,
+			Title:      albumResp.Name,
+			AlbumName:  albumResp.Name,
+			AlbumCover: firstImage(albumResp.Images),
+			Images:     albumResp.Images,
+			URL:        albumResp.ExternalURLs.Spotify,
+		}
+		for _, artist := range albumResp.Artists {
+			details.Artists = append(details.Artists, artist.Name)
+		}
+		if len(details.Artists) > 0 {
+			details.Artist = details.Artists[0]
+		}
+		return details, nil
+	case KindPlaylist:
+		var playlistResp SpotifyPlaylistResponse
+		if err := c.get(ctx, "/playlists/"+url.PathEscape(id)+"?fields=id,name,owner(display_name),images,external_urls", &playlistResp); err != nil {
+			return nil, err
+		}
+		return &TrackDetails{
+			Kind:       kind,
+			ID:         playlistResp.ID,
+			Title:      playlistResp.Name,
+			Artist:     playlistResp.Owner.DisplayName,
+			AlbumCover: firstImage(playlistResp.Images),
+			Images:     playlistResp.Images,
+			URL:        playlistResp.ExternalURLs.Spotify,
+		}, nil
+	case KindEpisode:
+		var episodeResp SpotifyEpisodeResponse
+		if err := c.get(ctx, "/episodes/"+url.PathEscape(id)+"?"+market, &episodeResp); err != nil {
+			return nil, err
+		}
+		images := episodeResp.Images
+		if len(images) == 0 {
+			images = episodeResp.Show.Images
+		}
+		details := &TrackDetails{
+			Kind:       kind,
+			ID:         episodeResp.ID,
+			Title:      episodeResp.Name,
+			Artist:     episodeResp.Show.Name,
+			AlbumName:  episodeResp.Show.Name,
+			AlbumCover: firstImage(images),
+			Images:     images,
+			DurationMs: episodeResp.DurationMs,
+			Explicit:   episodeResp.Explicit,
+			URL:        episodeResp.ExternalURLs.Spotify,
+		}
+		if episodeResp.AudioPreviewURL != nil {
+			details.PreviewURL = *episodeResp.AudioPreviewURL
+		}
+		return details, nil
+	case KindShow:
+		var showResp SpotifyShowResponse
+		if err := c.get(ctx, "/shows/"+url.PathEscape(id)+"?"+market, &showResp); err != nil {
+			return nil, err
+		}
+		return &TrackDetails{
+			Kind:       kind,
+			ID:         showResp.ID,
+			Title:      showResp.Name,
+			Artist:     showResp.Publisher,
+			AlbumCover: firstImage(showResp.Images),
+			Images:     showResp.Images,
+			URL:        showResp.ExternalURLs.Spotify,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported Spotify item kind: %s", kind)
+}
+
+func firstImage(images []SpotifyImage) string {
+	if len(images) > 0 {
+		return images[0].URL
+	}
+	return ""
+}
+
+func (c *Client) FetchTrackDetails(ctx context.Context, trackID string) (*TrackDetails, error) {
 	var trackResp SpotifyTrackResponse
-	if err := json.Unmarshal(body, &trackResp); err != nil {
+	if err := c.get(ctx, "/tracks/"+url.PathEscape(trackID), &trackResp); err != nil {
 		return nil, err
 	}
+	return trackDetails(&trackResp), nil
+}
 
-	details := &TrackDetails{
-		Title:  trackResp.Name,
-		Artist: trackResp.Artists[0].Name,
+// SearchISRC finds the Spotify track for an ISRC, used to link songs shared from other services
+func (c *Client) SearchISRC(ctx context.Context, isrc string) (*TrackDetails, error) {
+	params := url.Values{}
+	params.Set("q", "isrc:"+isrc)
+	params.Set("type", "track")
+	params.Set("limit", "1")
+
+	var searchResp SpotifySearchResponse
+	if err := c.get(ctx, "/search?"+params.Encode(), &searchResp); err != nil {
+		return nil, err
 	}
-	if len(trackResp.Album.Images) > 0 {
-		details.AlbumCover = trackResp.Album.Images[0].URL
+	if len(searchResp.Tracks.Items) == 0 {
+		return nil, fmt.Errorf("no Spotify track for ISRC %s", isrc)
 	}
-
-	return details, nil
+	return trackDetails(&searchResp.Tracks.Items[0]), nil
 }
 
-func ParseTrackID(songURL string) (string, error) {
-	if !strings.Contains(songURL, "spotify.com/track/") {
-		return "", fmt.Errorf("invalid Spotify URL")
+func trackDetails(trackResp *SpotifyTrackResponse) *TrackDetails {
+	details := &TrackDetails{
+		Kind:       KindTrack,
+		ID:         trackResp.ID,
+		Title:      trackResp.Name,
+		AlbumName:  trackResp.Album.Name,
+		AlbumCover: firstImage(trackResp.Album.Images),
+		Images:     trackResp.Album.Images,
+		DurationMs: trackResp.DurationMs,
+		Explicit:   trackResp.Explicit,
+		ISRC:       trackResp.ExternalIDs.ISRC,
+		URL:        trackResp.ExternalURLs.Spotify,
 	}
-
-	parts := strings.Split(songURL, "/track/")
-	if len(parts) < 2 {
-		return "", fmt.Errorf("invalid Spotify URL")
+	// local files and some podcast-backed tracks come back without artists
+	for _, artist := range trackResp.Artists {
+		details.Artists = append(details.Artists, artist.Name)
 	}
-
-	trackID := strings.Split(parts[1], "?")[0]
-	return trackID, nil
+	if len(details.Artists) > 0 {
+		details.Artist = details.Artists[0]
+	}
+	if trackResp.PreviewURL != nil {
+		details.PreviewURL = *trackResp.PreviewURL
+	}
+	return details
 }
@@ -0,0 +1,207 @@
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAccounts is a stand-in for accounts.spotify.com that counts token requests
+type fakeAccounts struct {
+	*httptest.Server
+	posts     atomic.Int32
+	expiresIn int
+	release   chan struct{} // if set, token requests wait for it to close
+}
+
+func newFakeAccounts(t *testing.T, expiresIn int) *fakeAccounts {
+	f := &fakeAccounts{expiresIn: expiresIn}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/token" {
+			http.NotFound(w, r)
+			return
+		}
+		if user, pass, ok := r.BasicAuth(); !ok || user != "id" || pass != "secret" {
+			http.Error(w, "bad client credentials", http.StatusUnauthorized)
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		if f.release != nil {
+			<-f.release
+		}
+		n := f.posts.Add(1)
+		json.NewEncoder(w).Encode(SpotifyTokenResponse{
+			AccessToken: fmt.Sprintf("token-%d", n),
+			TokenType:   "Bearer",
+			ExpiresIn:   f.expiresIn,
+		})
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestClient(accountsURL string) (*Client, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client := NewClient("id", "secret")
+	client.AccountsURL = accountsURL
+	client.now = clock.Now
+	return client, clock
+}
+
+func mustToken(t *testing.T, c *Client) string {
+	t.Helper()
+	token, err := c.AccessToken()
+	if err != nil {
+		t.Fatalf("AccessToken: %v", err)
+	}
+	return token
+}
+
+func TestAccessTokenReusedBeforeExpiry(t *testing.T) {
+	accounts := newFakeAccounts(t, 3600)
+	client, clock := newTestClient(accounts.URL)
+
+	first := mustToken(t, client)
+	clock.Advance(58 * time.Minute)
+	if second := mustToken(t, client); second != first {
+		t.Errorf("token changed before expiry: %q then %q", first, second)
+	}
+	if n := accounts.posts.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+}
+
+func TestAccessTokenRefreshedAfterExpiry(t *testing.T) {
+	accounts := newFakeAccounts(t, 3600)
+	client, clock := newTestClient(accounts.URL)
+
+	first := mustToken(t, client)
+	// inside the expiry margin counts as expired
+	clock.Advance(59*time.Minute + time.Second)
+	second := mustToken(t, client)
+	if second == first {
+		t.Errorf("token not refreshed after expiry: %q", second)
+	}
+	if n := accounts.posts.Load(); n != 2 {
+		t.Errorf("token requests = %d, want 2", n)
+	}
+}
+
+func TestAccessTokenShortLifetime(t *testing.T) {
+	accounts := newFakeAccounts(t, 30)
+	client, clock := newTestClient(accounts.URL)
+
+	first := mustToken(t, client)
+	clock.Advance(10 * time.Second)
+	if second := mustToken(t, client); second != first {
+		t.Errorf("short-lived token refetched on every call: %q then %q", first, second)
+	}
+	clock.Advance(10 * time.Second)
+	if third := mustToken(t, client); third == first {
+		t.Errorf("short-lived token kept past half its life")
+	}
+}
+
+func TestAccessTokenConcurrentCallersShareOneRequest(t *testing.T) {
+	accounts := newFakeAccounts(t, 3600)
+	accounts.release = make(chan struct{})
+	client, _ := newTestClient(accounts.URL)
+
+	const callers = 20
+	var started, done sync.WaitGroup
+	tokens := make([]string, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		done.Add(1)
+		go func(i int) {
+			defer done.Done()
+			started.Done()
+			tokens[i], errs[i] = client.AccessToken()
+		}(i)
+	}
+	started.Wait()
+	// give every caller time to reach the shared refresh before the token comes back
+	time.Sleep(50 * time.Millisecond)
+	close(accounts.release)
+	done.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil {
+			t.Fatalf("caller %d: %v", i, errs[i])
+		}
+		if tokens[i] != tokens[0] {
+			t.Errorf("caller %d got %q, want %q", i, tokens[i], tokens[0])
+		}
+	}
+	if n := accounts.posts.Load(); n != 1 {
+		t.Errorf("token requests = %d, want 1", n)
+	}
+}
+
+func TestAccessTokenError(t *testing.T) {
+	accounts := newFakeAccounts(t, 3600)
+	client, _ := newTestClient(accounts.URL)
+	client.ClientSecret = "wrong"
+
+	if _, err := client.AccessToken(); err == nil {
+		t.Fatal("AccessToken succeeded with bad credentials")
+	}
+	if n := accounts.posts.Load(); n != 0 {
+		t.Errorf("token requests = %d, want 0", n)
+	}
+}
+
+// a hung API call gives up when the job running it is cancelled, rather than waiting out the HTTP client's timeout
+func TestFetchDetailsHonoursContext(t *testing.T) {
+	accounts := newFakeAccounts(t, 3600)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(api.Close)
+	client, _ := newTestClient(accounts.URL)
+	client.APIURL = api.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	for _, call := range []func() error{
+		func() error { _, err := client.FetchDetails(ctx, KindAlbum, "1"); return err },
+		func() error { _, err := client.FetchTrackDetails(ctx, "1"); return err },
+		func() error { _, err := client.SearchISRC(ctx, "GBDUW0000059"); return err },
+	} {
+		if err := call(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("call with an expired context = %v, want DeadlineExceeded", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("calls took %v after the context expired", elapsed)
+	}
+}
@@ -0,0 +1,182 @@
+package spotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UserScopes are what we ask for when a user links their account: enough to find and manage our playlist, nothing more
+var UserScopes = []string{"playlist-read-private", "playlist-modify-private", "playlist-modify-public"}
+
+var (
+	// ErrNotFound is returned when a user resource no longer exists
+	ErrNotFound = errors.New("Spotify resource not found")
+	// ErrPlaylistNotFound is returned when the playlist itself is gone, usually because the user deleted it
+	ErrPlaylistNotFound = errors.New("Spotify playlist not found")
+)
+
+type SpotifyUser struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+}
+
+type SpotifyPlaylist struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	ExternalURLs struct {
+		Spotify string `json:"spotify"`
+	} `json:"external_urls"`
+}
+
+// AuthorizeURL is where we send a user to grant access to their account
+func (c *Client) AuthorizeURL(state, redirectURL string) string {
+	params := url.Values{}
+	params.Set("client_id", c.ClientID)
+	params.Set("response_type", "code")
+	params.Set("redirect_uri", redirectURL)
+	params.Set("state", state)
+	params.Set("scope", strings.Join(UserScopes, " "))
+	return c.AccountsURL + "/authorize?" + params.Encode()
+}
+
+func (c *Client) ExchangeCode(code, redirectURL string) (*SpotifyTokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", redirectURL)
+	return c.postToken(data)
+}
+
+// RefreshUserToken trades a refresh token for a new access token; Spotify may also rotate the refresh token
+func (c *Client) RefreshUserToken(refreshToken string) (*SpotifyTokenResponse, error) {
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", refreshToken)
+	return c.postToken(data)
+}
+
+func (c *Client) userRequest(accessToken, method, path string, payload, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.APIURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Spotify API error: %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (c *Client) CurrentUser(accessToken string) (*SpotifyUser, error) {
+	var user SpotifyUser
+	if err := c.userRequest(accessToken, "GET", "/me", nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (c *Client) CreatePlaylist(accessToken, userID, name, description string) (*SpotifyPlaylist, error) {
+	payload := map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"public":      false,
+	}
+	var playlist SpotifyPlaylist
+	if err := c.userRequest(accessToken, "POST", "/users/"+url.PathEscape(userID)+"/playlists", payload, &playlist); err != nil {
+		return nil, err
+	}
+	return &playlist, nil
+}
+
+// AddToPlaylist appends items (as spotify: URIs) to the end of a playlist
+func (c *Client) AddToPlaylist(accessToken, playlistID string, uris ...string) error {
+	payload := map[string]interface{}{"uris": uris}
+	err := c.userRequest(accessToken, "POST", "/playlists/"+url.PathEscape(playlistID)+"/tracks", payload, nil)
+	return c.playlistError(accessToken, playlistID, err)
+}
+
+// playlistError turns a 404 from one of a playlist's endpoints into ErrPlaylistNotFound, but only when the
+// playlist itself is gone; a 404 can also come from something else in the request
+func (c *Client) playlistError(accessToken, playlistID string, err error) error {
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	var playlist SpotifyPlaylist
+	if lookupErr := c.userRequest(accessToken, "GET", "/playlists/"+url.PathEscape(playlistID)+"?fields=id", nil, &playlist); errors.Is(lookupErr, ErrNotFound) {
+		return ErrPlaylistNotFound
+	}
+	return err
+}
+
+type playlistItemsPage struct {
+	Items []struct {
+		Track *struct {
+			URI string `json:"uri"`
+		} `json:"track"`
+	} `json:"items"`
+	Total int `json:"total"`
+}
+
+// playlistPageSize is the most items Spotify returns per page
+const playlistPageSize = 100
+
+// PlaylistContains reports whether the playlist already has the item, paging through the whole playlist
+func (c *Client) PlaylistContains(accessToken, playlistID, uri string) (bool, error) {
+	for offset := 0; ; {
+		params := url.Values{}
+		params.Set("fields", "items(track(uri)),total")
+		params.Set("limit", fmt.Sprint(playlistPageSize))
+		params.Set("offset", fmt.Sprint(offset))
+
+		var page playlistItemsPage
+		if err := c.userRequest(accessToken, "GET", "/playlists/"+url.PathEscape(playlistID)+"/tracks?"+params.Encode(), nil, &page); err != nil {
+			return false, c.playlistError(accessToken, playlistID, err)
+		}
+		for _, item := range page.Items {
+			// removed or unavailable items come back with a null track
+			if item.Track != nil && item.Track.URI == uri {
+				return true, nil
+			}
+		}
+		offset += len(page.Items)
+		if len(page.Items) == 0 || offset >= page.Total {
+			return false, nil
+		}
+	}
+}
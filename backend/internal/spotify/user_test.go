@@ -0,0 +1,236 @@
+package spotify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// stubSpotify fakes the accounts and Web API endpoints a linked user account uses, keeping playlists in memory
+type stubSpotify struct {
+	*httptest.Server
+	mu        sync.Mutex
+	playlists map[string][]string
+	adds      int
+}
+
+const (
+	stubAccessToken  = "user-access"
+	stubRefreshToken = "user-refresh"
+	// adding this track 404s even though the playlist is there
+	unavailableTrackURI = "spotify:track:unavailable"
+)
+
+func newStubSpotify(t *testing.T) *stubSpotify {
+	s := &stubSpotify{playlists: map[string][]string{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "id" || pass != "secret" {
+			http.Error(w, "invalid_client", http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.FormValue("grant_type") == "authorization_code" && r.FormValue("code") == "good-code" && r.FormValue("redirect_uri") == "https://app.example/spotify/callback":
+			json.NewEncoder(w).Encode(SpotifyTokenResponse{AccessToken: stubAccessToken, RefreshToken: stubRefreshToken, ExpiresIn: 3600})
+		case r.FormValue("grant_type") == "refresh_token" && strings.HasPrefix(r.FormValue("refresh_token"), stubRefreshToken):
+			// spotify sometimes rotates the refresh token
+			json.NewEncoder(w).Encode(SpotifyTokenResponse{AccessToken: stubAccessToken, RefreshToken: stubRefreshToken + "-2", ExpiresIn: 3600})
+		default:
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+		}
+	})
+	mux.HandleFunc("GET /v1/me", s.authed(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(SpotifyUser{ID: "listener", DisplayName: "Listener"})
+	}))
+	mux.HandleFunc("POST /v1/users/{user}/playlists", s.authed(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Name   string `json:"name"`
+			Public bool   `json:"public"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.Public {
+			http.Error(w, "bad playlist", http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		id := fmt.Sprintf("playlist%d", len(s.playlists)+1)
+		s.playlists[id] = nil
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": %q, "name": %q, "external_urls": {"spotify": "https://open.spotify.com/playlist/%s"}}`, id, body.Name, id)
+	}))
+	mux.HandleFunc("GET /v1/playlists/{id}", s.authed(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.playlists[r.PathValue("id")]; !ok {
+			http.Error(w, `{"error": {"status": 404}}`, http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"id": %q}`, r.PathValue("id"))
+	}))
+	mux.HandleFunc("/v1/playlists/{id}/tracks", s.authed(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		items, ok := s.playlists[r.PathValue("id")]
+		if !ok {
+			http.Error(w, `{"error": {"status": 404}}`, http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case http.MethodPost:
+			var body struct {
+				URIs []string `json:"uris"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, uri := range body.URIs {
+				if uri == unavailableTrackURI {
+					http.Error(w, `{"error": {"status": 404}}`, http.StatusNotFound)
+					return
+				}
+			}
+			s.playlists[r.PathValue("id")] = append(items, body.URIs...)
+			s.adds++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"snapshot_id": "abc"}`))
+		case http.MethodGet:
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			if limit <= 0 || limit > 100 {
+				http.Error(w, "bad limit", http.StatusBadRequest)
+				return
+			}
+			var page []map[string]interface{}
+			for i := offset; i < len(items) && i < offset+limit; i++ {
+				page = append(page, map[string]interface{}{"track": map[string]string{"uri": items[i]}})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"items": page, "total": len(items)})
+		}
+	}))
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *stubSpotify) authed(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+stubAccessToken {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *stubSpotify) client() *Client {
+	client := NewClient("id", "secret")
+	client.AccountsURL = s.URL
+	client.APIURL = s.URL + "/v1"
+	client.HTTPClient = s.Server.Client()
+	return client
+}
+
+func TestAuthorizeURL(t *testing.T) {
+	client := NewClient("id", "secret")
+	u, err := url.Parse(client.AuthorizeURL("state123", "https://app.example/spotify/callback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Host != "accounts.spotify.com" || u.Path != "/authorize" {
+		t.Errorf("AuthorizeURL points at %s%s", u.Host, u.Path)
+	}
+	if q.Get("client_id") != "id" || q.Get("state") != "state123" || q.Get("response_type") != "code" ||
+		q.Get("redirect_uri") != "https://app.example/spotify/callback" {
+		t.Errorf("AuthorizeURL query = %v", q)
+	}
+	if q.Get("scope") != "playlist-read-private playlist-modify-private playlist-modify-public" {
+		t.Errorf("scope = %q", q.Get("scope"))
+	}
+}
+
+func TestExchangeAndRefresh(t *testing.T) {
+	client := newStubSpotify(t).client()
+
+	token, err := client.ExchangeCode("good-code", "https://app.example/spotify/callback")
+	if err != nil {
+		t.Fatalf("ExchangeCode: %v", err)
+	}
+	if token.AccessToken != stubAccessToken || token.RefreshToken != stubRefreshToken {
+		t.Errorf("ExchangeCode = %+v", token)
+	}
+	if _, err := client.ExchangeCode("bad-code", "https://app.example/spotify/callback"); err == nil {
+		t.Error("ExchangeCode accepted a bad code")
+	}
+
+	refreshed, err := client.RefreshUserToken(token.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshUserToken: %v", err)
+	}
+	if refreshed.RefreshToken != stubRefreshToken+"-2" {
+		t.Errorf("rotated refresh token = %q", refreshed.RefreshToken)
+	}
+	if _, err := client.RefreshUserToken("revoked"); err == nil {
+		t.Error("RefreshUserToken accepted a revoked token")
+	}
+}
+
+func TestPlaylistLifecycle(t *testing.T) {
+	stub := newStubSpotify(t)
+	client := stub.client()
+
+	user, err := client.CurrentUser(stubAccessToken)
+	if err != nil {
+		t.Fatalf("CurrentUser: %v", err)
+	}
+	if user.ID != "listener" || user.DisplayName != "Listener" {
+		t.Errorf("CurrentUser = %+v", user)
+	}
+	if _, err := client.CurrentUser("expired"); err == nil {
+		t.Error("CurrentUser succeeded with a bad token")
+	}
+
+	playlist, err := client.CreatePlaylist(stubAccessToken, user.ID, "good morning", "every song")
+	if err != nil {
+		t.Fatalf("CreatePlaylist: %v", err)
+	}
+	if playlist.ID == "" || playlist.ExternalURLs.Spotify != "https://open.spotify.com/playlist/"+playlist.ID {
+		t.Errorf("CreatePlaylist = %+v", playlist)
+	}
+
+	// more than one page, so PlaylistContains has to keep going
+	var uris []string
+	for i := 0; i < 250; i++ {
+		uris = append(uris, fmt.Sprintf("spotify:track:%022d", i))
+	}
+	if err := client.AddToPlaylist(stubAccessToken, playlist.ID, uris...); err != nil {
+		t.Fatalf("AddToPlaylist: %v", err)
+	}
+
+	for _, uri := range []string{uris[0], uris[150], uris[249]} {
+		found, err := client.PlaylistContains(stubAccessToken, playlist.ID, uri)
+		if err != nil || !found {
+			t.Errorf("PlaylistContains(%s) = %v, %v; want true", uri, found, err)
+		}
+	}
+	found, err := client.PlaylistContains(stubAccessToken, playlist.ID, "spotify:track:missing")
+	if err != nil || found {
+		t.Errorf("PlaylistContains(missing) = %v, %v; want false", found, err)
+	}
+
+	if err := client.AddToPlaylist(stubAccessToken, "deleted", uris[0]); !errors.Is(err, ErrPlaylistNotFound) {
+		t.Errorf("AddToPlaylist to a deleted playlist = %v, want ErrPlaylistNotFound", err)
+	}
+	if _, err := client.PlaylistContains(stubAccessToken, "deleted", uris[0]); !errors.Is(err, ErrPlaylistNotFound) {
+		t.Errorf("PlaylistContains on a deleted playlist = %v, want ErrPlaylistNotFound", err)
+	}
+	// a 404 for something else in the request doesn't mean the playlist is gone
+	if err := client.AddToPlaylist(stubAccessToken, playlist.ID, unavailableTrackURI); !errors.Is(err, ErrNotFound) || errors.Is(err, ErrPlaylistNotFound) {
+		t.Errorf("AddToPlaylist of an unavailable track = %v, want ErrNotFound", err)
+	}
+}
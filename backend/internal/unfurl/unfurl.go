@@ -0,0 +1,278 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	DefaultMaxBytes = 512 * 1024 // previews live in <head>, we never need the whole page
+	DefaultTimeout  = 5 * time.Second
+	maxRedirects    = 5
+
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+)
+
+var (
+	ErrInvalidURL = errors.New("link must be an http or https URL")
+	ErrForbidden  = errors.New("link points at a private or reserved address")
+	ErrNotHTML    = errors.New("link is not an HTML page")
+	ErrNoPreview  = errors.New("page has no preview metadata")
+)
+
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// Unfurler fetches Open Graph / Twitter card metadata without letting users make us talk to internal hosts
+type Unfurler struct {
+	HTTPClient *http.Client
+	MaxBytes   int64
+}
+
+func New() *Unfurler {
+	return newWithResolver(nil)
+}
+
+// newWithResolver is New with the DNS resolver swapped out; nil uses the system's
+func newWithResolver(resolver *net.Resolver) *Unfurler {
+	dialer := &net.Dialer{
+		Timeout:  DefaultTimeout,
+		Resolver: resolver,
+		Control:  dialControl,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   DefaultTimeout,
+		ResponseHeaderTimeout: DefaultTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
+	return &Unfurler{
+		HTTPClient: &http.Client{
+			Timeout:   DefaultTimeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= maxRedirects {
+					return errors.New("too many redirects")
+				}
+				return ValidateURL(req.URL)
+			},
+		},
+		MaxBytes: DefaultMaxBytes,
+	}
+}
+
+// dialControl runs at connect time, after DNS, so a hostname's answers (and rebinding) can't route us inward
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+var reservedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // "this" network
+		"100.64.0.0/10", // carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"192.0.2.0/24",  // documentation
+		"198.18.0.0/15", // benchmarking
+		"198.51.100.0/24",
+		"203.0.113.0/24",
+		"240.0.0.0/4",  // reserved
+		"64:ff9b::/96", // NAT64, could map onto private v4
+		"2001:db8::/32",
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateURL checks the parts of a link we can check before connecting
+func ValidateURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ErrInvalidURL
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		return ErrForbidden
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !IsPublicIP(ip) {
+		return ErrForbidden
+	}
+	if host := strings.TrimSuffix(strings.ToLower(u.Hostname()), "."); host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+		return ErrForbidden
+	}
+	return nil
+}
+
+func (u *Unfurler) Fetch(ctx context.Context, rawURL string) (*Preview, error) {
+	target, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, ErrInvalidURL
+	}
+	if err := ValidateURL(target); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "good-morning-link-preview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := u.HTTPClient.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbidden) {
+			return nil, ErrForbidden
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNotHTML
+	}
+
+	preview := parse(io.LimitReader(resp.Body, u.MaxBytes), resp.Request.URL)
+	if preview.Title == "" && preview.Description == "" && preview.Image == "" {
+		return nil, ErrNoPreview
+	}
+	preview.URL = resp.Request.URL.String()
+	return preview, nil
+}
+
+// parse reads meta tags from the document head, preferring Open Graph over Twitter cards over plain HTML
+func parse(r io.Reader, base *url.URL) *Preview {
+	meta := map[string]string{}
+	var title string
+	inTitle := false
+
+	z := html.NewTokenizer(r)
+loop:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			break loop
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				break loop
+			case "title":
+				inTitle = true
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch strings.ToLower(string(k)) {
+					case "property", "name":
+						key = strings.ToLower(string(v))
+					case "content":
+						content = string(v)
+					}
+				}
+				if key != "" && content != "" {
+					if _, seen := meta[key]; !seen {
+						meta[key] = content
+					}
+				}
+			}
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				break loop
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := strings.TrimSpace(meta[k]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+
+	preview := &Preview{
+		Title:       truncate(first("og:title", "twitter:title"), maxTitleLength),
+		Description: truncate(first("og:description", "twitter:description", "description"), maxDescriptionLength),
+		SiteName:    truncate(first("og:site_name", "application-name"), maxTitleLength),
+	}
+	if preview.Title == "" {
+		preview.Title = truncate(strings.TrimSpace(title), maxTitleLength)
+	}
+	if image := first("og:image:secure_url", "og:image", "og:image:url", "twitter:image", "twitter:image:src"); image != "" {
+		if ref, err := url.Parse(image); err == nil {
+			if resolved := base.ResolveReference(ref); resolved.Scheme == "http" || resolved.Scheme == "https" {
+				preview.Image = resolved.String()
+			}
+		}
+	}
+	return preview
+}
+
+func truncate(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
@@ -15,7 +15,13 @@ import {
     SelectValue,
 } from "@/components/ui/select";
 import { Card, CardContent, CardHeader, CardTitle } from "@/components/ui/card";
-import { checkAuth, createNotice, type User } from "@/lib/api";
+import {
+    API_BASE_URL,
+    csrfHeaders,
+    checkAuth,
+    createNotice,
+    type User,
+} from "@/lib/api";
 import { Label } from "@/components/ui/label";
 
 const colors = [
@@ -113,9 +119,11 @@ export default function CreateNoticePage() {
             formDataUpload.append("image", selectedFile);
 
             try {
-                const response = await fetch("/api/upload", {
+                const response = await fetch(`${API_BASE_URL}/media/photo`, {
                     method: "POST",
                     body: formDataUpload,
+                    credentials: "include",
+                    headers: csrfHeaders(),
                 });
 
                 if (response.ok) {
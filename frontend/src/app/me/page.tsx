@@ -7,7 +7,16 @@ import { Button } from "@/components/ui/button";
 import { Input } from "@/components/ui/input";
 import { Card, CardContent } from "@/components/ui/card";
 import Avatar from "@/components/Avatar";
-import { checkAuth, getUserData, editUsername, type User } from "@/lib/api";
+import {
+    checkAuth,
+    getUserData,
+    editUsername,
+    deleteAccount,
+    cancelAccountDeletion,
+    linkEmail,
+    type User,
+} from "@/lib/api";
+import { passkeysSupported, registerPasskey } from "@/lib/passkeys";
 
 export default function MePage() {
     const [authenticated, setAuthenticated] = useState(false);
@@ -17,6 +26,10 @@ export default function MePage() {
     const [editMode, setEditMode] = useState(false);
     const [loading, setLoading] = useState(true);
     const [message, setMessage] = useState("");
+    const [deleteMode, setDeleteMode] = useState(false);
+    const [deleteConfirm, setDeleteConfirm] = useState("");
+    const [reauthenticate, setReauthenticate] = useState(false);
+    const [loginEmail, setLoginEmail] = useState("");
     const router = useRouter();
 
     useEffect(() => {
@@ -47,6 +60,55 @@ export default function MePage() {
         }
     };
 
+    const handleAddPasskey = async () => {
+        try {
+            if (await registerPasskey()) {
+                setMessage("passkey added");
+            }
+        } catch (error: unknown) {
+            console.error("failed to add passkey:", error);
+            setMessage("failed to add passkey");
+        }
+    };
+
+    const handleLinkEmail = async () => {
+        if (!loginEmail.trim()) {
+            return;
+        }
+        const result = await linkEmail(loginEmail.trim());
+        setMessage(result.message);
+        if (result.success) {
+            setLoginEmail("");
+        }
+    };
+
+    const handleDeleteAccount = async () => {
+        const result = await deleteAccount(deleteConfirm);
+        setMessage(result.message);
+        if (!result.success) {
+            setReauthenticate(result.reauthenticate === true);
+            return;
+        }
+        if (!result.deleteAfter) {
+            router.push("/");
+            return;
+        }
+        const userData = await getUserData();
+        setUser(userData.user);
+        setDeleteConfirm("");
+        setDeleteMode(false);
+    };
+
+    const handleCancelDeletion = async () => {
+        if (await cancelAccountDeletion()) {
+            setMessage("account deletion cancelled");
+            const userData = await getUserData();
+            setUser(userData.user);
+        } else {
+            setMessage("failed to cancel account deletion");
+        }
+    };
+
     const handleLogout = () => {
         window.location.href = `${process.env.NEXT_PUBLIC_BACKEND_URL}/logout`;
     };
@@ -113,14 +175,109 @@ export default function MePage() {
                         <p className="text-2xl font-semibold">
                             {partner.username}
                         </p>
+                        {partner.deleteAfter && (
+                            <p className="text-center">
+                                {partner.username}&apos;s account will be
+                                deleted on{" "}
+                                {new Date(partner.deleteAfter).toLocaleString()}
+                                , along with your notices to each other
+                            </p>
+                        )}
                     </CardContent>
                 </Card>
             )}
+            <Card className="min-w-sm">
+                <CardContent className="flex flex-col items-center gap-4">
+                    <p className="text-xl font-semibold">Email Login</p>
+                    <Input
+                        type="email"
+                        value={loginEmail}
+                        onChange={(e) => setLoginEmail(e.target.value)}
+                        placeholder="you@example.com"
+                    />
+                    <Button variant="outline" onClick={handleLinkEmail}>
+                        Send Confirmation Link
+                    </Button>
+                </CardContent>
+            </Card>
+            <Card className="min-w-sm">
+                <CardContent className="flex flex-col items-center gap-4">
+                    <p className="text-xl font-semibold">Delete Account</p>
+                    {user.deleteAfter ? (
+                        <>
+                            <p className="text-center">
+                                Your account will be deleted on{" "}
+                                {new Date(user.deleteAfter).toLocaleString()}
+                            </p>
+                            <Button onClick={handleCancelDeletion}>
+                                Keep My Account
+                            </Button>
+                        </>
+                    ) : deleteMode ? (
+                        <>
+                            <p className="text-center">
+                                This unpairs you and removes your notices,
+                                photos and voice notes. Type{" "}
+                                <span className="font-semibold">
+                                    {user.username}
+                                </span>{" "}
+                                to confirm.
+                            </p>
+                            <Input
+                                type="text"
+                                value={deleteConfirm}
+                                onChange={(e) =>
+                                    setDeleteConfirm(e.target.value)
+                                }
+                                placeholder="Username"
+                            />
+                            <div className="flex gap-2">
+                                {reauthenticate ? (
+                                    <Button
+                                        variant="destructive"
+                                        onClick={handleLogout}
+                                    >
+                                        Sign In Again
+                                    </Button>
+                                ) : (
+                                    <Button
+                                        variant="destructive"
+                                        onClick={handleDeleteAccount}
+                                        disabled={
+                                            deleteConfirm !== user.username
+                                        }
+                                    >
+                                        Delete Account
+                                    </Button>
+                                )}
+                                <Button
+                                    onClick={() => setDeleteMode(false)}
+                                    variant="outline"
+                                >
+                                    Cancel
+                                </Button>
+                            </div>
+                        </>
+                    ) : (
+                        <Button
+                            variant="outline"
+                            onClick={() => setDeleteMode(true)}
+                        >
+                            Delete Account
+                        </Button>
+                    )}
+                </CardContent>
+            </Card>
             {message && <p>{message}</p>}
             <div className="flex gap-2 justify-center min-w-sm">
                 <Link href="/" className="cursor-pointer">
                     <Button variant="outline">Back to Home</Button>
                 </Link>
+                {passkeysSupported() && (
+                    <Button variant="outline" onClick={handleAddPasskey}>
+                        Add Passkey
+                    </Button>
+                )}
                 <Button variant="outline" onClick={handleLogout}>
                     Log Out
                 </Button>
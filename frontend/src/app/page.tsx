@@ -7,7 +7,8 @@ import { Input } from "@/components/ui/input";
 import { Card, CardContent } from "@/components/ui/card";
 import Avatar from "@/components/Avatar";
 import {
-    loginWithGoogle,
+    loginWith,
+    requestMagicLink,
     checkAuth,
     pairUser,
     getUserData,
@@ -15,6 +16,7 @@ import {
     type User,
     type Notice,
 } from "@/lib/api";
+import { loginWithPasskey, passkeysSupported } from "@/lib/passkeys";
 import Image from "next/image";
 import { Plus } from "lucide-react";
 
@@ -27,6 +29,8 @@ export default function Home() {
     const [alreadySent, setAlreadySent] = useState(false);
     const [pairCode, setPairCode] = useState("");
     const [pairMessage, setPairMessage] = useState("");
+    const [loginEmail, setLoginEmail] = useState("");
+    const [loginMessage, setLoginMessage] = useState("");
     const [menuOpen, setMenuOpen] = useState(false);
     const [loading, setLoading] = useState(true);
     const [showInstallPrompt, setShowInstallPrompt] = useState(false);
@@ -265,9 +269,55 @@ export default function Home() {
                             )}
                         </div>
                     ) : (
-                        <Button onClick={loginWithGoogle} variant="outline">
-                            Login with Google
-                        </Button>
+                        <div className="flex flex-col items-center gap-2">
+                            <Button
+                                onClick={() => loginWith("google")}
+                                variant="outline"
+                            >
+                                Login with Google
+                            </Button>
+                            <Button
+                                onClick={() => loginWith("github")}
+                                variant="outline"
+                            >
+                                Login with GitHub
+                            </Button>
+                            {passkeysSupported() && (
+                                <Button
+                                    onClick={async () => {
+                                        try {
+                                            if (await loginWithPasskey()) {
+                                                window.location.reload();
+                                            }
+                                        } catch {
+                                            setLoginMessage(
+                                                "passkey sign-in failed"
+                                            );
+                                        }
+                                    }}
+                                    variant="outline"
+                                >
+                                    Sign in with a passkey
+                                </Button>
+                            )}
+                            <Input
+                                type="email"
+                                value={loginEmail}
+                                onChange={(e) => setLoginEmail(e.target.value)}
+                                placeholder="or get a link by email"
+                            />
+                            <Button
+                                onClick={async () => {
+                                    const result =
+                                        await requestMagicLink(loginEmail);
+                                    setLoginMessage(result.message);
+                                }}
+                                variant="outline"
+                            >
+                                Email me a link
+                            </Button>
+                            {loginMessage && <p>{loginMessage}</p>}
+                        </div>
                     )}
                 </div>
             )}
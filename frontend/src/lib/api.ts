@@ -1,11 +1,62 @@
-import axios from "axios";
+import axios, { AxiosError, InternalAxiosRequestConfig } from "axios";
 
-const API_BASE_URL =
+export const API_BASE_URL =
     process.env.NEXT_PUBLIC_BACKEND_URL || "http://localhost:24804";
 
 const api = axios.create({
     baseURL: API_BASE_URL,
     withCredentials: true, // include cookies for JWT
+    // double-submit csrf: echo the backend's csrf cookie on unsafe requests, even cross-origin
+    xsrfCookieName: "csrf_token",
+    xsrfHeaderName: "X-CSRF-Token",
+    withXSRFToken: true,
+});
+
+// csrfHeaders is for requests made with fetch rather than the axios instance
+export function csrfHeaders(): Record<string, string> {
+    const match = document.cookie.match(/(?:^|;\s*)csrf_token=([^;]*)/);
+    return match ? { "X-CSRF-Token": decodeURIComponent(match[1]) } : {};
+}
+
+// access tokens are short-lived; on a 401, refresh the session once and retry.
+// concurrent failures share a single refresh so the refresh token is only rotated once
+let refreshing: Promise<boolean> | null = null;
+
+function refreshSession(): Promise<boolean> {
+    if (!refreshing) {
+        refreshing = api
+            .post("/auth/refresh")
+            .then(() => true)
+            // 409 means another tab rotated the token first; its new cookie is already set
+            .catch(
+                (error: unknown) =>
+                    axios.isAxiosError(error) &&
+                    error.response?.status === 409
+            )
+            .finally(() => {
+                refreshing = null;
+            });
+    }
+    return refreshing;
+}
+
+api.interceptors.response.use(undefined, async (error: AxiosError) => {
+    const config = error.config as
+        | (InternalAxiosRequestConfig & { _retried?: boolean })
+        | undefined;
+    if (
+        error.response?.status !== 401 ||
+        !config ||
+        config._retried ||
+        config.url === "/auth/refresh"
+    ) {
+        return Promise.reject(error);
+    }
+    config._retried = true;
+    if (await refreshSession()) {
+        return api(config);
+    }
+    return Promise.reject(error);
 });
 
 export interface User {
@@ -14,6 +65,7 @@ export interface User {
     email: string;
     uniqueCode: string;
     picture?: string;
+    deleteAfter?: string | null;
     partner?: User;
 }
 
@@ -167,8 +219,124 @@ export async function getNotice(): Promise<{ notice: Notice | null }> {
     return { notice: null };
 }
 
-export function loginWithGoogle() {
-    window.location.href = `${API_BASE_URL}/auth/google`;
+// deleteAccount schedules the account for deletion; confirm must be the user's username
+export async function deleteAccount(
+    confirm: string
+): Promise<{
+    success: boolean;
+    message: string;
+    deleteAfter?: string;
+    reauthenticate?: boolean;
+}> {
+    try {
+        const response = await api.delete("/user", { data: { confirm } });
+        return {
+            success: true,
+            message: response.data.message,
+            deleteAfter: response.data.deleteAfter,
+        };
+    } catch (error: unknown) {
+        if (axios.isAxiosError(error)) {
+            return {
+                success: false,
+                message:
+                    error.response?.data?.error || "failed to delete account",
+                reauthenticate: error.response?.data?.reauthenticate === true,
+            };
+        }
+        return { success: false, message: "failed to delete account" };
+    }
+}
+
+export async function cancelAccountDeletion(): Promise<boolean> {
+    try {
+        await api.post("/user/cancel-deletion");
+        return true;
+    } catch (error: unknown) {
+        if (axios.isAxiosError(error) && error.response?.status !== 401) {
+            console.error("failed to cancel account deletion:", error);
+        }
+    }
+    return false;
+}
+
+export interface Session {
+    id: string;
+    device: string;
+    userAgent: string;
+    ip: string;
+    lastSeenAt: string;
+    createdAt: string;
+    current: boolean;
+}
+
+export async function getSessions(): Promise<Session[]> {
+    try {
+        const response = await api.get("/sessions");
+        return response.data.sessions;
+    } catch (error: unknown) {
+        if (axios.isAxiosError(error) && error.response?.status !== 401) {
+            console.error("failed to get sessions:", error);
+        }
+    }
+    return [];
+}
+
+export async function revokeSession(id: string): Promise<boolean> {
+    try {
+        await api.delete(`/sessions/${encodeURIComponent(id)}`);
+        return true;
+    } catch (error: unknown) {
+        if (axios.isAxiosError(error) && error.response?.status !== 401) {
+            console.error("failed to revoke session:", error);
+        }
+    }
+    return false;
+}
+
+export function loginWith(provider: string, returnTo?: string) {
+    const query = returnTo
+        ? `?returnTo=${encodeURIComponent(returnTo)}`
+        : "";
+    window.location.href = `${API_BASE_URL}/auth/${provider}${query}`;
+}
+
+export async function requestMagicLink(
+    email: string
+): Promise<{ success: boolean; message: string }> {
+    try {
+        const response = await api.post("/auth/email", { email });
+        return { success: true, message: response.data.message };
+    } catch (error: unknown) {
+        if (axios.isAxiosError(error)) {
+            return {
+                success: false,
+                message: error.response?.data?.error || "failed to send link",
+            };
+        }
+        return { success: false, message: "failed to send link" };
+    }
+}
+
+// emails a link that adds the address as a login method for the signed-in account
+export async function linkEmail(
+    email: string
+): Promise<{ success: boolean; message: string }> {
+    try {
+        const response = await api.post("/identities/email", {
+            email,
+            returnTo: "/me",
+        });
+        return { success: true, message: response.data.message };
+    } catch (error: unknown) {
+        if (axios.isAxiosError(error)) {
+            return {
+                success: false,
+                message: error.response?.data?.error || "failed to send link",
+            };
+        }
+        return { success: false, message: "failed to send link" };
+    }
 }
 
 export default api;
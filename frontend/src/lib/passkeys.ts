@@ -0,0 +1,112 @@
+import api from "@/lib/api";
+
+// WebAuthn options arrive as JSON with base64url-encoded binary fields; the browser API wants ArrayBuffers
+
+function fromBase64URL(value: string): ArrayBuffer {
+    const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    const padded = base64.padEnd(Math.ceil(base64.length / 4) * 4, "=");
+    const binary = atob(padded);
+    const bytes = new Uint8Array(binary.length);
+    for (let i = 0; i < binary.length; i++) {
+        bytes[i] = binary.charCodeAt(i);
+    }
+    return bytes.buffer;
+}
+
+function toBase64URL(buffer: ArrayBuffer): string {
+    const bytes = new Uint8Array(buffer);
+    let binary = "";
+    for (const byte of bytes) {
+        binary += String.fromCharCode(byte);
+    }
+    return btoa(binary)
+        .replace(/\+/g, "-")
+        .replace(/\//g, "_")
+        .replace(/=+$/, "");
+}
+
+interface CredentialDescriptorJSON {
+    type: PublicKeyCredentialType;
+    id: string;
+    transports?: AuthenticatorTransport[];
+}
+
+export function passkeysSupported(): boolean {
+    return typeof window !== "undefined" && !!window.PublicKeyCredential;
+}
+
+export async function registerPasskey(name?: string): Promise<boolean> {
+    const { data } = await api.post("/passkeys/register/begin");
+    const options = data.publicKey;
+
+    const credential = (await navigator.credentials.create({
+        publicKey: {
+            ...options,
+            challenge: fromBase64URL(options.challenge),
+            user: { ...options.user, id: fromBase64URL(options.user.id) },
+            excludeCredentials: (options.excludeCredentials ?? []).map(
+                (c: CredentialDescriptorJSON) => ({
+                    ...c,
+                    id: fromBase64URL(c.id),
+                })
+            ),
+        },
+    })) as PublicKeyCredential | null;
+    if (!credential) {
+        return false;
+    }
+
+    const response = credential.response as AuthenticatorAttestationResponse;
+    await api.post(
+        "/passkeys/register/finish",
+        {
+            id: credential.id,
+            rawId: toBase64URL(credential.rawId),
+            type: credential.type,
+            response: {
+                clientDataJSON: toBase64URL(response.clientDataJSON),
+                attestationObject: toBase64URL(response.attestationObject),
+                transports: response.getTransports?.() ?? [],
+            },
+        },
+        { params: name ? { name } : undefined }
+    );
+    return true;
+}
+
+export async function loginWithPasskey(): Promise<boolean> {
+    const { data } = await api.post("/auth/passkey/begin");
+    const options = data.publicKey;
+
+    const credential = (await navigator.credentials.get({
+        publicKey: {
+            ...options,
+            challenge: fromBase64URL(options.challenge),
+            allowCredentials: (options.allowCredentials ?? []).map(
+                (c: CredentialDescriptorJSON) => ({
+                    ...c,
+                    id: fromBase64URL(c.id),
+                })
+            ),
+        },
+    })) as PublicKeyCredential | null;
+    if (!credential) {
+        return false;
+    }
+
+    const response = credential.response as AuthenticatorAssertionResponse;
+    await api.post("/auth/passkey/finish", {
+        id: credential.id,
+        rawId: toBase64URL(credential.rawId),
+        type: credential.type,
+        response: {
+            clientDataJSON: toBase64URL(response.clientDataJSON),
+            authenticatorData: toBase64URL(response.authenticatorData),
+            signature: toBase64URL(response.signature),
+            userHandle: response.userHandle
+                ? toBase64URL(response.userHandle)
+                : undefined,
+        },
+    });
+    return true;
+}
@@ -4,5 +4,5 @@ set -e
 
 cd backend
 go mod tidy
-go build -o server cmd/server/main.go
+go build -o server ./cmd/server
 cd ..
\ No newline at end of file